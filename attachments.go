@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+	"github.com/whatsmynameagain/go-chirpy/internal/media"
+	"github.com/whatsmynameagain/go-chirpy/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// images are uploaded on their own first, POST /api/attachments, and then
+// posted with a chirp by ID, each with its alt text. Uploads are checked
+// and cleaned up by internal/media and kept in blob storage, only their
+// details are in the database. Who can fetch one follows the chirp it's on,
+// before that (or while the chirp is scheduled) only the uploader can.
+
+const (
+	maxChirpAttachments = 4
+	maxAltTextLength    = 1000
+	// uploads that haven't been posted on a chirp by then are deleted
+	attachmentUploadTTL = 24 * time.Hour
+	// how many expired attachments are deleted per query
+	attachmentPurgeBatch = 100
+	// room for the multipart boundaries and headers around the file
+	multipartOverhead = 64 << 10
+)
+
+var errAttachmentUnavailable = errors.New("attachment not found")
+
+type Attachment struct {
+	ID           uuid.UUID `json:"id"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int32     `json:"size_bytes"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	AltText      string    `json:"alt_text"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+}
+
+// attachmentRef is how a chirp being posted names an upload
+type attachmentRef struct {
+	ID      uuid.UUID `json:"id"`
+	AltText string    `json:"alt_text"`
+}
+
+// openBlobStorage sets up the storage MEDIA_STORAGE names: "disk", under
+// MEDIA_DIR, or "s3" with the S3_* settings. Unset means no storage, and
+// uploads are turned off.
+func openBlobStorage() (storage.Storage, error) {
+	switch backend := os.Getenv("MEDIA_STORAGE"); backend {
+	case "":
+		return nil, nil
+	case "disk":
+		// not somewhere under the server's working directory, /app/ serves
+		// all of it and would hand out every attachment to anyone
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			return nil, errors.New("MEDIA_DIR must be set for disk storage")
+		}
+		return storage.NewDisk(dir)
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("MEDIA_STORAGE must be disk or s3, not %q", backend)
+	}
+}
+
+func dbAttachmentToJSON(a *database.Attachment) Attachment {
+	url := "/api/attachments/" + a.ID.String()
+	return Attachment{
+		ID:           a.ID,
+		ContentType:  a.ContentType,
+		SizeBytes:    a.SizeBytes,
+		Width:        a.Width,
+		Height:       a.Height,
+		AltText:      a.AltText,
+		URL:          url,
+		ThumbnailURL: url + "/thumbnail",
+	}
+}
+
+// uploadAttachment takes one image, in the "file" field of a multipart form
+func (cfg *apiConfig) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if cfg.blobs == nil {
+		respondWithError(w, 503, "attachment uploads are not enabled")
+		return
+	}
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxUploadBytes+multipartOverhead)
+	defer r.Body.Close()
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, 400, "expected a multipart/form-data upload")
+		return
+	}
+
+	var data []byte
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondWithUploadError(w, err)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		data, err = io.ReadAll(io.LimitReader(part, cfg.maxUploadBytes+1))
+		part.Close()
+		if err != nil {
+			respondWithUploadError(w, err)
+			return
+		}
+		break
+	}
+	if data == nil {
+		respondWithError(w, 400, "missing file")
+		return
+	}
+	if int64(len(data)) > cfg.maxUploadBytes {
+		respondWithError(w, 413, fmt.Sprintf("file is too large (max %d bytes)", cfg.maxUploadBytes))
+		return
+	}
+
+	img, err := media.Process(data)
+	if err != nil {
+		if errors.Is(err, media.ErrUnsupported) {
+			respondWithError(w, 415, err.Error())
+			return
+		}
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	id := uuid.New()
+	params := database.CreateAttachmentParams{
+		ID:                   id,
+		UserID:               user.ID,
+		ContentType:          img.ContentType,
+		SizeBytes:            int32(len(img.Data)),
+		Width:                int32(img.Width),
+		Height:               int32(img.Height),
+		StorageKey:           "attachments/" + id.String(),
+		ThumbnailKey:         "attachments/" + id.String() + "-thumbnail",
+		ThumbnailContentType: img.ThumbnailType,
+	}
+
+	// blobs first, a row without them would be a broken attachment
+	err = cfg.blobs.Put(r.Context(), params.StorageKey, img.ContentType, img.Data)
+	if err == nil {
+		err = cfg.blobs.Put(r.Context(), params.ThumbnailKey, img.ThumbnailType, img.Thumbnail)
+	}
+	var attachment database.Attachment
+	if err == nil {
+		attachment, err = cfg.dbQueries.CreateAttachment(r.Context(), params)
+	}
+	if err != nil {
+		fmt.Println("error saving attachment: ", err)
+		cfg.deleteBlobs(context.Background(), params.StorageKey, params.ThumbnailKey)
+		respondWithError(w, 500, "failed to save attachment")
+		return
+	}
+
+	respondWithJSON(w, 201, dbAttachmentToJSON(&attachment))
+}
+
+// respondWithUploadError answers for an upload that couldn't be read
+func respondWithUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, 413, "upload is too large")
+		return
+	}
+	respondWithError(w, 400, "could not read upload")
+}
+
+func (cfg *apiConfig) getAttachment(w http.ResponseWriter, r *http.Request) {
+	cfg.serveAttachment(w, r, false)
+}
+
+func (cfg *apiConfig) getAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	cfg.serveAttachment(w, r, true)
+}
+
+// serveAttachment sends an attachment's image, or its thumbnail, if the
+// viewer can see the chirp it's on. An upload that isn't on a chirp yet is
+// only for the uploader.
+func (cfg *apiConfig) serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	const notFound = "no attachment found with the requested ID"
+
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	attachmentID, err := uuid.Parse(r.PathValue("attachmentID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid attachment ID")
+		return
+	}
+
+	attachment, err := cfg.dbQueries.GetAttachmentByID(r.Context(), attachmentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, notFound)
+			return
+		}
+		fmt.Println("error fetching attachment: ", err)
+		respondWithError(w, 500, "failed to fetch attachment")
+		return
+	}
+
+	if !attachment.ChirpID.Valid {
+		// posted on a chirp that's since been purged, or not posted yet (or
+		// waiting on a scheduled chirp)
+		purged := attachment.Position.Valid && !attachment.ScheduledChirpID.Valid
+		if purged || viewer == uuid.Nil || viewer != attachment.UserID {
+			respondWithError(w, 404, notFound)
+			return
+		}
+	} else {
+		chrp, err := cfg.dbQueries.GetChirpByID(r.Context(), attachment.ChirpID.UUID)
+		if err != nil {
+			fmt.Println("error fetching attachment chirp: ", err)
+			respondWithError(w, 500, "failed to fetch attachment")
+			return
+		}
+		if cfg.respondIfHidden(w, r, viewer, &chrp, notFound) {
+			return
+		}
+		if chrp.DeletedAt.Valid {
+			respondWithError(w, 404, notFound)
+			return
+		}
+	}
+
+	if cfg.blobs == nil {
+		respondWithError(w, 503, "attachments are not enabled")
+		return
+	}
+	key, contentType := attachment.StorageKey, attachment.ContentType
+	if thumbnail {
+		key, contentType = attachment.ThumbnailKey, attachment.ThumbnailContentType
+	}
+	blob, err := cfg.blobs.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, 404, notFound)
+			return
+		}
+		fmt.Println("error fetching attachment blob: ", err)
+		respondWithError(w, 500, "failed to fetch attachment")
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// private: whether the viewer may see it can change, with a block or an
+	// unfollow
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, blob)
+	if err != nil {
+		fmt.Println("error sending attachment: ", err)
+	}
+}
+
+// checkAttachmentRefs validates the attachments of a chirp being posted,
+// before anything touches the database
+func checkAttachmentRefs(refs []attachmentRef) error {
+	if len(refs) > maxChirpAttachments {
+		return fmt.Errorf("a chirp can have at most %d attachments", maxChirpAttachments)
+	}
+	seen := make(map[uuid.UUID]bool, len(refs))
+	for _, ref := range refs {
+		if seen[ref.ID] {
+			return fmt.Errorf("attachment %s is listed twice", ref.ID)
+		}
+		seen[ref.ID] = true
+		if utf8.RuneCountInString(ref.AltText) > maxAltTextLength {
+			return fmt.Errorf("alt text is too long (max %d characters)", maxAltTextLength)
+		}
+	}
+	return nil
+}
+
+// attachToChirp puts the uploads on a new chirp, in the order given. It
+// fails with errAttachmentUnavailable for an upload that isn't the author's
+// or was already posted.
+func attachToChirp(ctx context.Context, qtx *database.Queries, author, chirpID uuid.UUID, refs []attachmentRef) error {
+	for i, ref := range refs {
+		attached, err := qtx.AttachToChirp(ctx, database.AttachToChirpParams{
+			ChirpID:  uuid.NullUUID{UUID: chirpID, Valid: true},
+			Position: sql.NullInt32{Int32: int32(i), Valid: true},
+			AltText:  ref.AltText,
+			ID:       ref.ID,
+			UserID:   author,
+		})
+		if err != nil {
+			return err
+		}
+		if attached == 0 {
+			return fmt.Errorf("%w: %s", errAttachmentUnavailable, ref.ID)
+		}
+	}
+	return nil
+}
+
+// chirpAttachments loads the attachments of chirps, in their order on each
+func (cfg *apiConfig) chirpAttachments(ctx context.Context, chirpIDs []uuid.UUID) (map[uuid.UUID][]Attachment, error) {
+	rows, err := cfg.dbQueries.GetChirpAttachments(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	attachments := make(map[uuid.UUID][]Attachment, len(rows))
+	for i := range rows {
+		chirpID := rows[i].ChirpID.UUID
+		attachments[chirpID] = append(attachments[chirpID], dbAttachmentToJSON(&rows[i]))
+	}
+	return attachments, nil
+}
+
+// purgeAttachments deletes uploads nobody posted in time and the
+// attachments of purged chirps, blobs first so a failure leaves the row to
+// try again next time
+func (cfg *apiConfig) purgeAttachments(ctx context.Context) {
+	if cfg.blobs == nil {
+		return
+	}
+	cutoff := time.Now().UTC().Add(-attachmentUploadTTL)
+	purged := 0
+	for {
+		expired, err := cfg.dbQueries.GetExpiredAttachments(ctx, database.GetExpiredAttachmentsParams{
+			CreatedAt: cutoff,
+			Limit:     attachmentPurgeBatch,
+		})
+		if err != nil {
+			log.Printf("error fetching expired attachments: %v", err)
+			break
+		}
+		for i := range expired {
+			err = cfg.deleteBlobs(ctx, expired[i].StorageKey, expired[i].ThumbnailKey)
+			if err == nil {
+				err = cfg.dbQueries.DeleteAttachment(ctx, expired[i].ID)
+			}
+			if err != nil {
+				log.Printf("error purging attachment %s: %v", expired[i].ID, err)
+				break
+			}
+			purged++
+		}
+		if err != nil || len(expired) < attachmentPurgeBatch {
+			break
+		}
+	}
+	if purged > 0 {
+		log.Printf("purged %d attachments", purged)
+	}
+}
+
+func (cfg *apiConfig) deleteBlobs(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		err := cfg.blobs.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// a block works in both directions: neither user can follow, reply to,
+// mention or see the other, and they're left out of each other's listings.
+// A mute only hides the muted account from the muter's timeline and
+// notifications, the muted account isn't told and can still see everything.
+
+type UserList struct {
+	Users []UserSummary `json:"users"`
+}
+
+// blockedBetween is true when either user has blocked the other. An anonymous
+// viewer (uuid.Nil) is never blocked.
+func (cfg *apiConfig) blockedBetween(ctx context.Context, a, b uuid.UUID) (bool, error) {
+	if a == uuid.Nil || b == uuid.Nil {
+		return false, nil
+	}
+	return cfg.dbQueries.IsBlocked(ctx, database.IsBlockedParams{UserA: a, UserB: b})
+}
+
+// blockedUsers is the set of users blocked either way with the viewer, for
+// filtering chirps that are fetched by ID rather than listed
+func (cfg *apiConfig) blockedUsers(ctx context.Context, viewer uuid.UUID) (map[uuid.UUID]bool, error) {
+	blocked := map[uuid.UUID]bool{}
+	if viewer == uuid.Nil {
+		return blocked, nil
+	}
+	userIDs, err := cfg.dbQueries.GetBlockedUserIDs(ctx, viewer)
+	if err != nil {
+		return nil, err
+	}
+	for _, userID := range userIDs {
+		blocked[userID] = true
+	}
+	return blocked, nil
+}
+
+// respondIfBlocked answers 404 when the viewer and the owner of what's being
+// looked at have blocked each other, as if it didn't exist. It returns true
+// if a response was written.
+func (cfg *apiConfig) respondIfBlocked(w http.ResponseWriter, r *http.Request, viewer, owner uuid.UUID, notFound string) bool {
+	blocked, err := cfg.blockedBetween(r.Context(), viewer, owner)
+	if err != nil {
+		fmt.Println("error checking blocks: ", err)
+		respondWithError(w, 500, "failed to check blocks")
+		return true
+	}
+	if blocked {
+		respondWithError(w, 404, notFound)
+		return true
+	}
+	return false
+}
+
+// removeFollow deletes a follow along with what hangs off it: the follower
+// count and the followee's chirps in the follower's timeline
+func removeFollow(ctx context.Context, qtx *database.Queries, follower, followee uuid.UUID) error {
+	deleted, err := qtx.DeleteFollow(ctx, database.DeleteFollowParams{
+		FollowerID: follower,
+		FolloweeID: followee,
+	})
+	if err != nil || deleted == 0 {
+		return err
+	}
+
+	err = qtx.AddToFollowerCount(ctx, database.AddToFollowerCountParams{
+		Delta: -1,
+		ID:    followee,
+	})
+	if err != nil {
+		return err
+	}
+	return qtx.RemoveAuthorFromTimeline(ctx, database.RemoveAuthorFromTimelineParams{
+		UserID:   follower,
+		AuthorID: followee,
+	})
+}
+
+// blockUser blocks a user and drops any follows, and follow requests, between
+// the two
+func (cfg *apiConfig) blockUser(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	blockedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if blockedID == user.ID {
+		respondWithError(w, 400, "you can't block yourself")
+		return
+	}
+
+	_, err = cfg.dbQueries.GetUserByID(r.Context(), blockedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no user found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching user: ", err)
+		respondWithError(w, 500, "failed to block user")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to block user")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	_, err = qtx.CreateBlock(r.Context(), database.CreateBlockParams{
+		BlockerID: user.ID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		fmt.Println("error creating block: ", err)
+		respondWithError(w, 500, "failed to block user")
+		return
+	}
+
+	err = removeFollow(r.Context(), qtx, user.ID, blockedID)
+	if err == nil {
+		err = removeFollow(r.Context(), qtx, blockedID, user.ID)
+	}
+	if err == nil {
+		_, err = qtx.DeleteFollowRequest(r.Context(), database.DeleteFollowRequestParams{
+			RequesterID: user.ID,
+			TargetID:    blockedID,
+		})
+	}
+	if err == nil {
+		_, err = qtx.DeleteFollowRequest(r.Context(), database.DeleteFollowRequestParams{
+			RequesterID: blockedID,
+			TargetID:    user.ID,
+		})
+	}
+	if err != nil {
+		fmt.Println("error removing follows: ", err)
+		respondWithError(w, 500, "failed to block user")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing block: ", err)
+		respondWithError(w, 500, "failed to block user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unblockUser lifts a block, the follows it removed stay removed
+func (cfg *apiConfig) unblockUser(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	blockedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+
+	err = cfg.dbQueries.DeleteBlock(r.Context(), database.DeleteBlockParams{
+		BlockerID: user.ID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		fmt.Println("error deleting block: ", err)
+		respondWithError(w, 500, "failed to unblock user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) muteUser(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	mutedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if mutedID == user.ID {
+		respondWithError(w, 400, "you can't mute yourself")
+		return
+	}
+
+	_, err = cfg.dbQueries.GetUserByID(r.Context(), mutedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no user found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching user: ", err)
+		respondWithError(w, 500, "failed to mute user")
+		return
+	}
+
+	err = cfg.dbQueries.CreateMute(r.Context(), database.CreateMuteParams{
+		MuterID: user.ID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		fmt.Println("error creating mute: ", err)
+		respondWithError(w, 500, "failed to mute user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unmuteUser(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	mutedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+
+	err = cfg.dbQueries.DeleteMute(r.Context(), database.DeleteMuteParams{
+		MuterID: user.ID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		fmt.Println("error deleting mute: ", err)
+		respondWithError(w, 500, "failed to unmute user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getBlocks lists the accounts the caller has blocked, newest first. Who has
+// blocked the caller is never shown.
+func (cfg *apiConfig) getBlocks(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetBlocks(r.Context(), database.GetBlocksParams{
+		BlockerID: user.ID,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching blocks: ", err)
+		respondWithError(w, 500, "failed to fetch blocked users")
+		return
+	}
+
+	resp := UserList{Users: []UserSummary{}}
+	for i := range rows {
+		resp.Users = append(resp.Users, UserSummary{
+			ID:        rows[i].ID,
+			Handle:    rows[i].Handle,
+			CreatedAt: rows[i].CreatedAt,
+			BlockedAt: &rows[i].BlockedAt,
+		})
+	}
+	respondWithJSON(w, 200, resp)
+}
+
+// getMutes lists the accounts the caller has muted, newest first
+func (cfg *apiConfig) getMutes(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetMutes(r.Context(), database.GetMutesParams{
+		MuterID: user.ID,
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching mutes: ", err)
+		respondWithError(w, 500, "failed to fetch muted users")
+		return
+	}
+
+	resp := UserList{Users: []UserSummary{}}
+	for i := range rows {
+		resp.Users = append(resp.Users, UserSummary{
+			ID:        rows[i].ID,
+			Handle:    rows[i].Handle,
+			CreatedAt: rows[i].CreatedAt,
+			MutedAt:   &rows[i].MutedAt,
+		})
+	}
+	respondWithJSON(w, 200, resp)
+}
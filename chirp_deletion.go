@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// deleted chirps stay in the table (with deleted_at set) for
+// cfg.chirpRetention so moderators still have the evidence and replies keep
+// their context, then the purge job removes them for good
+
+const chirpPurgeInterval = time.Hour
+
+// ChirpTombstone is what's served in place of a deleted chirp
+type ChirpTombstone struct {
+	ID        uuid.UUID `json:"id"`
+	Deleted   bool      `json:"deleted"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func respondWithTombstone(w http.ResponseWriter, chrp *database.Chirp) {
+	err := respondWithJSON(w, http.StatusGone, ChirpTombstone{
+		ID:        chrp.ID,
+		Deleted:   true,
+		DeletedAt: chrp.DeletedAt.Time,
+	})
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
+
+func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to delete chirp")
+		return
+	}
+
+	if chirp.UserID != user.ID {
+		respondWithError(w, 403, "you can only delete your own chirps")
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithTombstone(w, &chirp)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to delete chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.DeleteChirp(r.Context(), chirp.ID)
+	if err == nil {
+		err = publishEvent(r.Context(), qtx, eventChirpDeleted, chirpEvent{
+			ChirpID: chirp.ID,
+			UserID:  chirp.UserID,
+			RootID:  conversationRoot(&chirp),
+			// deletes go to the same audience as the chirp did
+			Visibility: chirp.Visibility,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Println("error deleting chirp: ", err)
+		respondWithError(w, 500, "failed to delete chirp")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreChirp undoes a delete, as long as the purge job hasn't gotten to it
+func (cfg *apiConfig) restoreChirp(w http.ResponseWriter, r *http.Request) {
+	admin, err := cfg.authenticateAdmin(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	restored, err := cfg.dbQueries.RestoreChirp(r.Context(), database.RestoreChirpParams{
+		ID:        chirpID,
+		DeletedAt: sql.NullTime{Time: time.Now().UTC().Add(-cfg.chirpRetention), Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no deleted chirp within the retention period found with the requested ID")
+			return
+		}
+		fmt.Println("error restoring chirp: ", err)
+		respondWithError(w, 500, "failed to restore chirp")
+		return
+	}
+
+	cfg.respondWithChirp(w, r, admin.ID, 200, &restored)
+}
+
+// runChirpPurger deletes chirps that have been soft-deleted for longer than
+// the retention period, and the attachments nothing uses anymore, once every
+// chirpPurgeInterval until ctx is done
+func (cfg *apiConfig) runChirpPurger(ctx context.Context) {
+	ticker := time.NewTicker(chirpPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().UTC().Add(-cfg.chirpRetention)
+		purged, err := cfg.dbQueries.PurgeDeletedChirps(ctx, sql.NullTime{Time: cutoff, Valid: true})
+		if err != nil {
+			log.Printf("error purging deleted chirps: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d deleted chirps", purged)
+		}
+		cfg.purgeAttachments(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// QuotedChirp is the copy of a quoted chirp embedded in the chirp quoting it
+type QuotedChirp struct {
+	ID      uuid.UUID `json:"id"`
+	Deleted bool      `json:"deleted,omitempty"`
+	// set instead of the content when the viewer and the quoted author have
+	// blocked each other, or the viewer isn't allowed to see the quoted chirp
+	Unavailable bool       `json:"unavailable,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	Body        string     `json:"body,omitempty"`
+	UserID      *uuid.UUID `json:"user_id,omitempty"`
+}
+
+// chirpsToJSON converts chirps for a response and fills in everything that
+// lives outside the chirps row (counts and the like). Each extra field costs
+// one query for the whole list, never one per chirp. viewer is who the
+// response is for, uuid.Nil when anonymous.
+func (cfg *apiConfig) chirpsToJSON(ctx context.Context, viewer uuid.UUID, dbChirps []database.Chirp) ([]Chirp, error) {
+	jsonChirps := make([]Chirp, 0, len(dbChirps))
+	if len(dbChirps) == 0 {
+		return jsonChirps, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(dbChirps))
+	for i := range dbChirps {
+		ids = append(ids, dbChirps[i].ID)
+	}
+
+	replyCounts, err := cfg.dbQueries.CountReplies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	replies := make(map[uuid.UUID]int64, len(replyCounts))
+	for _, rc := range replyCounts {
+		replies[rc.InReplyTo.UUID] = rc.ReplyCount
+	}
+
+	rechirpCounts, err := cfg.dbQueries.CountRechirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	rechirps := make(map[uuid.UUID]int64, len(rechirpCounts))
+	for _, rc := range rechirpCounts {
+		rechirps[rc.ChirpID] = rc.RechirpCount
+	}
+
+	quoteCounts, err := cfg.dbQueries.CountQuotes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	quotes := make(map[uuid.UUID]int64, len(quoteCounts))
+	for _, qc := range quoteCounts {
+		quotes[qc.QuoteOf.UUID] = qc.QuoteCount
+	}
+
+	likeCounts, err := cfg.dbQueries.CountLikes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	likes := make(map[uuid.UUID]int64, len(likeCounts))
+	for _, lc := range likeCounts {
+		likes[lc.ChirpID] = lc.LikeCount
+	}
+
+	likedByViewer := map[uuid.UUID]bool{}
+	if viewer != uuid.Nil {
+		likedIDs, err := cfg.dbQueries.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+			UserID:   viewer,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range likedIDs {
+			likedByViewer[id] = true
+		}
+	}
+
+	quoted, err := cfg.quotedChirps(ctx, viewer, dbChirps)
+	if err != nil {
+		return nil, err
+	}
+
+	mentionRows, err := cfg.dbQueries.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentions := make(map[uuid.UUID][]database.ChirpMention, len(mentionRows))
+	for _, m := range mentionRows {
+		mentions[m.ChirpID] = append(mentions[m.ChirpID], m)
+	}
+
+	attachments, err := cfg.chirpAttachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	polls, err := cfg.chirpPolls(ctx, viewer, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range dbChirps {
+		chirp := dbChirpToJSONChirp(&dbChirps[i])
+		chirp.ReplyCount = replies[chirp.ID]
+		chirp.RechirpCount = rechirps[chirp.ID]
+		chirp.QuoteCount = quotes[chirp.ID]
+		chirp.LikeCount = likes[chirp.ID]
+		chirp.LikedByMe = likedByViewer[chirp.ID]
+		chirp.Mentions = mentionEntities(chirp.Body, mentions[chirp.ID])
+		chirp.Attachments = attachments[chirp.ID]
+		chirp.Poll = polls[chirp.ID]
+		if dbChirps[i].QuoteOf.Valid {
+			chirp.QuotedChirp = quoted[dbChirps[i].QuoteOf.UUID]
+		}
+		jsonChirps = append(jsonChirps, chirp)
+	}
+	return jsonChirps, nil
+}
+
+// quotedChirps loads the chirps quoted by any of dbChirps. Quotes of chirps
+// that were deleted (or purged since) get a stub that only says so.
+func (cfg *apiConfig) quotedChirps(ctx context.Context, viewer uuid.UUID, dbChirps []database.Chirp) (map[uuid.UUID]*QuotedChirp, error) {
+	var quotedIDs []uuid.UUID
+	for i := range dbChirps {
+		if dbChirps[i].QuoteOf.Valid {
+			quotedIDs = append(quotedIDs, dbChirps[i].QuoteOf.UUID)
+		}
+	}
+	quoted := make(map[uuid.UUID]*QuotedChirp, len(quotedIDs))
+	if len(quotedIDs) == 0 {
+		return quoted, nil
+	}
+
+	found, err := cfg.dbQueries.GetChirpsByIDs(ctx, quotedIDs)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := cfg.blockedUsers(ctx, viewer)
+	if err != nil {
+		return nil, err
+	}
+	viewable, err := cfg.viewableChirps(ctx, viewer, found)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		if found[i].DeletedAt.Valid {
+			continue
+		}
+		if blocked[found[i].UserID] || !viewable[found[i].ID] {
+			quoted[found[i].ID] = &QuotedChirp{ID: found[i].ID, Unavailable: true}
+			continue
+		}
+		quoted[found[i].ID] = &QuotedChirp{
+			ID:        found[i].ID,
+			CreatedAt: &found[i].CreatedAt,
+			Body:      found[i].Body,
+			UserID:    &found[i].UserID,
+		}
+	}
+	for _, id := range quotedIDs {
+		if _, ok := quoted[id]; !ok {
+			quoted[id] = &QuotedChirp{ID: id, Deleted: true}
+		}
+	}
+	return quoted, nil
+}
+
+// chirpToJSON is chirpsToJSON for a single chirp
+func (cfg *apiConfig) chirpToJSON(ctx context.Context, viewer uuid.UUID, chrp *database.Chirp) (Chirp, error) {
+	jsonChirps, err := cfg.chirpsToJSON(ctx, viewer, []database.Chirp{*chrp})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return jsonChirps[0], nil
+}
+
+// respondWithChirp sends a single chirp, with all the fields chirpsToJSON
+// fills in
+func (cfg *apiConfig) respondWithChirp(w http.ResponseWriter, r *http.Request, viewer uuid.UUID, code int, chrp *database.Chirp) {
+	jsonChirp, err := cfg.chirpToJSON(r.Context(), viewer, chrp)
+	if err != nil {
+		fmt.Println("error building chirp response: ", err)
+		respondWithError(w, 500, "failed to build chirp response")
+		return
+	}
+	err = respondWithJSON(w, code, jsonChirp)
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+type ChirpRevision struct {
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+func (cfg *apiConfig) editChirp(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type editReq struct {
+		Body string `json:"body"`
+	}
+
+	author, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+	editData := editReq{}
+	err = json.Unmarshal(data, &editData)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+
+	// same checks as createChirp
+	moderated, err := cfg.checkChirpBody(editData.Body)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// lock the row so two edits at once can't both save the same old version
+	current, err := qtx.GetChirpByIDForUpdate(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+
+	if current.UserID != author.ID {
+		respondWithError(w, 403, "you can only edit your own chirps")
+		return
+	}
+	if current.DeletedAt.Valid {
+		respondWithTombstone(w, &current)
+		return
+	}
+	if cfg.chirpEditWindow > 0 && time.Since(current.CreatedAt) > cfg.chirpEditWindow {
+		msg := fmt.Sprintf("chirps can only be edited within %s of posting", cfg.chirpEditWindow)
+		respondWithError(w, 403, msg)
+		return
+	}
+
+	// nothing changed, don't store a revision for it
+	if moderated.body == current.Body {
+		cfg.respondWithChirp(w, r, author.ID, 200, &current)
+		return
+	}
+
+	err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID:   current.ID,
+		Body:      current.Body,
+		CreatedAt: current.UpdatedAt,
+	})
+	if err != nil {
+		fmt.Println("error saving chirp revision: ", err)
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+
+	updated, err := qtx.UpdateChirp(r.Context(), database.UpdateChirpParams{
+		Body:       moderated.body,
+		FlaggedAt:  moderated.flaggedAt,
+		FlagReason: moderated.flagReason,
+		ID:         current.ID,
+	})
+	if err != nil {
+		fmt.Println("error updating chirp: ", err)
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+	err = saveHashtags(r.Context(), qtx, &updated)
+	if err != nil {
+		fmt.Println("error saving hashtags: ", err)
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+	// only who the edit adds gets told, the rest already were
+	previous, err := qtx.GetChirpMentions(r.Context(), []uuid.UUID{updated.ID})
+	if err != nil {
+		fmt.Println("error fetching mentions: ", err)
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+	mentioned, err := saveMentions(r.Context(), qtx, &updated)
+	if err != nil {
+		fmt.Println("error saving mentions: ", err)
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+	var added []uuid.UUID
+	for _, userID := range mentioned {
+		if !slices.ContainsFunc(previous, func(m database.ChirpMention) bool { return m.UserID == userID }) {
+			added = append(added, userID)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing chirp edit: ", err)
+		respondWithError(w, 500, "failed to edit chirp")
+		return
+	}
+
+	cfg.notifyMentioned(r.Context(), &updated, added, uuid.Nil)
+	if moderated.flaggedAt.Valid {
+		cfg.fileModerationReport(r.Context(), &updated)
+	}
+
+	cfg.respondWithChirp(w, r, author.ID, 200, &updated)
+}
+
+// getChirpHistory lists the earlier versions of a chirp, oldest first. The
+// current version is the chirp itself.
+func (cfg *apiConfig) getChirpHistory(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to fetch chirp history")
+		return
+	}
+	if cfg.respondIfHidden(w, r, viewer, &chirp, "no chirp found with the requested ID") {
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithTombstone(w, &chirp)
+		return
+	}
+
+	revisions, err := cfg.dbQueries.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		fmt.Println("error fetching chirp revisions: ", err)
+		respondWithError(w, 500, "failed to fetch chirp history")
+		return
+	}
+
+	jsonRevisions := []ChirpRevision{}
+	for _, rev := range revisions {
+		jsonRevisions = append(jsonRevisions, ChirpRevision{
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		})
+	}
+	respondWithJSON(w, 200, jsonRevisions)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// maintenance commands, run as `chirpy <command> [args]` instead of serving
+
+const commandUsage = `usage:
+  chirpy rebuild-timelines [user-id...]     rebuild materialized timelines (all users if none given)
+  chirpy check-timelines [-n N] [user-id...] compare timelines against the pull query
+  chirpy reindex-hashtags                   extract the hashtags of every chirp again`
+
+func (cfg *apiConfig) runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "rebuild-timelines":
+		userIDs, err := cfg.commandUserIDs(ctx, args[1:])
+		if err != nil {
+			return err
+		}
+		var total int64
+		for _, userID := range userIDs {
+			entries, err := cfg.rebuildTimeline(ctx, userID)
+			if err != nil {
+				return fmt.Errorf("rebuilding timeline for %s: %w", userID, err)
+			}
+			total += entries
+		}
+		fmt.Printf("rebuilt %d timelines (%d entries)\n", len(userIDs), total)
+		return nil
+
+	case "check-timelines":
+		args = args[1:]
+		n := int32(100)
+		if len(args) >= 2 && args[0] == "-n" {
+			parsed, err := strconv.ParseInt(args[1], 10, 32)
+			if err != nil || parsed <= 0 {
+				return fmt.Errorf("-n must be a positive integer")
+			}
+			n = int32(parsed)
+			args = args[2:]
+		}
+		userIDs, err := cfg.commandUserIDs(ctx, args)
+		if err != nil {
+			return err
+		}
+		inconsistent := 0
+		for _, userID := range userIDs {
+			missing, extra, err := cfg.checkTimeline(ctx, userID, n)
+			if err != nil {
+				return fmt.Errorf("checking timeline for %s: %w", userID, err)
+			}
+			if len(missing) == 0 && len(extra) == 0 {
+				continue
+			}
+			inconsistent++
+			fmt.Printf("%s: %d missing %v, %d extra %v\n", userID, len(missing), missing, len(extra), extra)
+		}
+		fmt.Printf("checked %d timelines, %d inconsistent\n", len(userIDs), inconsistent)
+		if inconsistent > 0 {
+			return fmt.Errorf("%d timelines are inconsistent, see rebuild-timelines", inconsistent)
+		}
+		return nil
+
+	case "reindex-hashtags":
+		reindexed, err := cfg.reindexHashtags(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reindexed hashtags of %d chirps\n", reindexed)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], commandUsage)
+}
+
+// commandUserIDs parses the user IDs given to a command, or lists every user
+// when there aren't any
+func (cfg *apiConfig) commandUserIDs(ctx context.Context, args []string) ([]uuid.UUID, error) {
+	if len(args) == 0 {
+		return cfg.dbQueries.ListUserIDs(ctx)
+	}
+	userIDs := make([]uuid.UUID, 0, len(args))
+	for _, arg := range args {
+		userID, err := uuid.Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q", arg)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
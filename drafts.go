@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// drafts are chirps still being written, kept so they can be picked up on
+// another device. They can be anything while they're drafts (too long, not
+// passing moderation, replying to a chirp that's since gone) and are only
+// held to the rules when checked or published. Publishing goes through
+// postChirp like any new chirp and deletes the draft along with it.
+
+// a draft can run past the chirp length while it's being cut down, but not
+// without end
+const maxDraftBytes = 16 << 10
+
+type Draft struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Body        string          `json:"body"`
+	Visibility  string          `json:"visibility"`
+	InReplyTo   *uuid.UUID      `json:"in_reply_to,omitempty"`
+	QuoteOf     *uuid.UUID      `json:"quote_of,omitempty"`
+	Attachments []attachmentRef `json:"attachments"`
+	Poll        *pollRequest    `json:"poll,omitempty"`
+}
+
+// DraftCheck is how a draft fares against the rules a chirp is posted under
+type DraftCheck struct {
+	// whether it would be accepted, as far as length and moderation go
+	Valid     bool `json:"valid"`
+	Length    int  `json:"length"`
+	MaxLength int  `json:"max_length"`
+	// the moderation rules that would reject it, or flag it for review
+	RejectedBy []string `json:"rejected_by"`
+	FlaggedBy  []string `json:"flagged_by"`
+	// the body as it would be posted, with whatever the rules censor masked
+	Body string `json:"body"`
+	// what's wrong with the poll, if anything
+	PollError string `json:"poll_error,omitempty"`
+}
+
+func dbDraftToJSON(d *database.Draft) (Draft, error) {
+	draft := Draft{
+		ID:         d.ID,
+		CreatedAt:  d.CreatedAt,
+		UpdatedAt:  d.UpdatedAt,
+		Body:       d.Body,
+		Visibility: d.Visibility,
+		InReplyTo:  nullUUIDPtr(d.InReplyTo),
+		QuoteOf:    nullUUIDPtr(d.QuoteOf),
+	}
+	err := json.Unmarshal(d.Attachments, &draft.Attachments)
+	if err != nil {
+		return Draft{}, err
+	}
+	if draft.Attachments == nil {
+		draft.Attachments = []attachmentRef{}
+	}
+	draft.Poll, err = parsePollJSON(d.Poll)
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+// draftToRequest is the chirp a draft would post
+func draftToRequest(d *Draft) chirpRequest {
+	return chirpRequest{
+		Body:        d.Body,
+		InReplyTo:   d.InReplyTo,
+		QuoteOf:     d.QuoteOf,
+		Visibility:  d.Visibility,
+		Attachments: d.Attachments,
+		Poll:        d.Poll,
+	}
+}
+
+// draftContent is what's saved of a draft from a request
+type draftContent struct {
+	req chirpRequest
+	// JSON, as the drafts row keeps them
+	attachments string
+	poll        string
+}
+
+// readDraftRequest reads a draft's content from a request body. Only what
+// has to hold for anything to be saved is checked.
+func readDraftRequest(r *http.Request) (draftContent, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return draftContent{}, errors.New("could not read request")
+	}
+	req := chirpRequest{}
+	err = json.Unmarshal(data, &req)
+	if err != nil {
+		return draftContent{}, errors.New("could not unmarshal data")
+	}
+	if len(req.Body) > maxDraftBytes {
+		return draftContent{}, fmt.Errorf("draft is too long (max %d bytes)", maxDraftBytes)
+	}
+	req.Visibility, err = parseVisibility(req.Visibility)
+	if err != nil {
+		return draftContent{}, err
+	}
+	err = checkAttachmentRefs(req.Attachments)
+	if err != nil {
+		return draftContent{}, err
+	}
+	if req.Poll != nil && len(req.Poll.Options) > maxPollOptions {
+		return draftContent{}, fmt.Errorf("a poll can have at most %d options", maxPollOptions)
+	}
+	if req.Attachments == nil {
+		req.Attachments = []attachmentRef{}
+	}
+
+	content := draftContent{req: req}
+	attachments, err := json.Marshal(req.Attachments)
+	if err != nil {
+		return draftContent{}, errors.New("could not encode attachments")
+	}
+	content.attachments = string(attachments)
+	content.poll, err = pollJSON(req.Poll)
+	if err != nil {
+		return draftContent{}, errors.New("could not encode poll")
+	}
+	return content, nil
+}
+
+func (cfg *apiConfig) createDraft(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	content, err := readDraftRequest(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	draft, err := cfg.dbQueries.CreateDraft(r.Context(), database.CreateDraftParams{
+		UserID:      user.ID,
+		Body:        content.req.Body,
+		Visibility:  content.req.Visibility,
+		InReplyTo:   uuidPtrToNull(content.req.InReplyTo),
+		QuoteOf:     uuidPtrToNull(content.req.QuoteOf),
+		Attachments: content.attachments,
+		Poll:        content.poll,
+	})
+	if err != nil {
+		fmt.Println("error creating draft: ", err)
+		respondWithError(w, 500, "failed to create draft")
+		return
+	}
+	respondWithDraft(w, 201, &draft)
+}
+
+func respondWithDraft(w http.ResponseWriter, code int, d *database.Draft) {
+	draft, err := dbDraftToJSON(d)
+	if err != nil {
+		fmt.Println("error reading draft: ", err)
+		respondWithError(w, 500, "failed to build draft response")
+		return
+	}
+	respondWithJSON(w, code, draft)
+}
+
+// listDrafts lists the caller's drafts, the last one worked on first
+func (cfg *apiConfig) listDrafts(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetDrafts(r.Context(), database.GetDraftsParams{
+		UserID: user.ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching drafts: ", err)
+		respondWithError(w, 500, "failed to fetch drafts")
+		return
+	}
+
+	drafts := make([]Draft, 0, len(rows))
+	for i := range rows {
+		draft, err := dbDraftToJSON(&rows[i])
+		if err != nil {
+			fmt.Println("error reading draft: ", err)
+			respondWithError(w, 500, "failed to fetch drafts")
+			return
+		}
+		drafts = append(drafts, draft)
+	}
+	respondWithJSON(w, 200, drafts)
+}
+
+// ownDraft fetches the draft in the path, if it's the user's. It answers
+// the request itself when it returns false.
+func (cfg *apiConfig) ownDraft(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (Draft, bool) {
+	draftID, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid draft ID")
+		return Draft{}, false
+	}
+	row, err := cfg.dbQueries.GetDraft(r.Context(), database.GetDraftParams{
+		ID:     draftID,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no draft found with the requested ID")
+			return Draft{}, false
+		}
+		fmt.Println("error fetching draft: ", err)
+		respondWithError(w, 500, "failed to fetch draft")
+		return Draft{}, false
+	}
+	draft, err := dbDraftToJSON(&row)
+	if err != nil {
+		fmt.Println("error reading draft: ", err)
+		respondWithError(w, 500, "failed to fetch draft")
+		return Draft{}, false
+	}
+	return draft, true
+}
+
+func (cfg *apiConfig) getDraft(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	draft, ok := cfg.ownDraft(w, r, user.ID)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, 200, draft)
+}
+
+// updateDraft replaces a draft's content with the request's
+func (cfg *apiConfig) updateDraft(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid draft ID")
+		return
+	}
+
+	content, err := readDraftRequest(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	draft, err := cfg.dbQueries.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		Body:        content.req.Body,
+		Visibility:  content.req.Visibility,
+		InReplyTo:   uuidPtrToNull(content.req.InReplyTo),
+		QuoteOf:     uuidPtrToNull(content.req.QuoteOf),
+		Attachments: content.attachments,
+		Poll:        content.poll,
+		ID:          draftID,
+		UserID:      user.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no draft found with the requested ID")
+			return
+		}
+		fmt.Println("error updating draft: ", err)
+		respondWithError(w, 500, "failed to update draft")
+		return
+	}
+	respondWithDraft(w, 200, &draft)
+}
+
+func (cfg *apiConfig) deleteDraft(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid draft ID")
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeleteDraft(r.Context(), database.DeleteDraftParams{
+		ID:     draftID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		fmt.Println("error deleting draft: ", err)
+		respondWithError(w, 500, "failed to delete draft")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "no draft found with the requested ID")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkDraft runs a draft through the length limit, the moderation rules
+// and the poll checks, the same ones prepareChirp applies when it's posted,
+// and says how it did on all of them rather than stopping at the first
+func (cfg *apiConfig) checkDraft(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	draft, ok := cfg.ownDraft(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	moderated := cfg.moderateChirp(draft.Body)
+	check := DraftCheck{
+		Length:     chirptext.Length(draft.Body),
+		MaxLength:  cfg.maxChirpLength,
+		RejectedBy: moderated.rejected,
+		FlaggedBy:  []string{},
+		Body:       moderated.body,
+	}
+	if check.RejectedBy == nil {
+		check.RejectedBy = []string{}
+	}
+	if moderated.flagReason.Valid {
+		check.FlaggedBy = strings.Split(moderated.flagReason.String, ",")
+	}
+	if draft.Poll != nil {
+		// as if it were published now
+		_, flagged, err := cfg.checkPoll(draft.Poll, time.Now())
+		if err != nil {
+			check.PollError = err.Error()
+		}
+		for _, rule := range flagged {
+			if !slices.Contains(check.FlaggedBy, rule) {
+				check.FlaggedBy = append(check.FlaggedBy, rule)
+			}
+		}
+	}
+	check.Valid = check.Length <= check.MaxLength && len(check.RejectedBy) == 0 && check.PollError == ""
+	respondWithJSON(w, 200, check)
+}
+
+// publishDraft posts a draft, or schedules it if the request has a
+// publish_at. The draft is deleted in the same transaction, so publishing
+// it twice at once only makes one chirp.
+func (cfg *apiConfig) publishDraft(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type publishReq struct {
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	// the body is optional
+	reqData := publishReq{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		err = json.Unmarshal(data, &reqData)
+		if err != nil {
+			respondWithError(w, 400, "could not unmarshal data")
+			return
+		}
+	}
+
+	draft, ok := cfg.ownDraft(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	req := draftToRequest(&draft)
+	cfg.postChirp(w, r, user.ID, &req, reqData.PublishAt, func(ctx context.Context, qtx *database.Queries) error {
+		deleted, err := qtx.DeleteDraft(ctx, database.DeleteDraftParams{
+			ID:     draft.ID,
+			UserID: user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return &chirpError{404, "no draft found with the requested ID"}
+		}
+		return nil
+	})
+}
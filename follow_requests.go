@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// a protected account approves its followers: following one leaves a
+// request for the owner to accept or reject, and until then the requester
+// sees its chirps like anyone else who doesn't follow it, which is not at
+// all (see can_view_chirp). Turning protection off accepts everything that's
+// still waiting.
+
+// requestFollow is followUser for a protected account
+func (cfg *apiConfig) requestFollow(w http.ResponseWriter, r *http.Request, requester uuid.UUID, target *database.User) {
+	following, err := cfg.dbQueries.IsFollowing(r.Context(), database.IsFollowingParams{
+		FollowerID: requester,
+		FolloweeID: target.ID,
+	})
+	if err != nil {
+		fmt.Println("error checking follow: ", err)
+		respondWithError(w, 500, "failed to follow user")
+		return
+	}
+	// followed before the account was protected, or already accepted
+	if following {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	created, err := cfg.dbQueries.CreateFollowRequest(r.Context(), database.CreateFollowRequestParams{
+		RequesterID: requester,
+		TargetID:    target.ID,
+	})
+	if err != nil {
+		fmt.Println("error creating follow request: ", err)
+		respondWithError(w, 500, "failed to follow user")
+		return
+	}
+	if created > 0 {
+		cfg.notify(r.Context(), notification{
+			recipient: target.ID,
+			actor:     requester,
+			kind:      notificationFollowRequest,
+		})
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// listFollowRequests lists the requests waiting on the caller, newest first
+func (cfg *apiConfig) listFollowRequests(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	total, err := cfg.dbQueries.CountFollowRequests(r.Context(), user.ID)
+	if err != nil {
+		fmt.Println("error counting follow requests: ", err)
+		respondWithError(w, 500, "failed to fetch follow requests")
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetFollowRequests(r.Context(), database.GetFollowRequestsParams{
+		TargetID: user.ID,
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching follow requests: ", err)
+		respondWithError(w, 500, "failed to fetch follow requests")
+		return
+	}
+
+	resp := FollowList{Total: total, Users: []UserSummary{}}
+	for i := range rows {
+		resp.Users = append(resp.Users, UserSummary{
+			ID:          rows[i].ID,
+			Handle:      rows[i].Handle,
+			CreatedAt:   rows[i].CreatedAt,
+			RequestedAt: &rows[i].RequestedAt,
+		})
+	}
+	respondWithJSON(w, 200, resp)
+}
+
+// acceptFollowRequest turns a request into a follow
+func (cfg *apiConfig) acceptFollowRequest(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	requesterID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to accept follow request")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	deleted, err := qtx.DeleteFollowRequest(r.Context(), database.DeleteFollowRequestParams{
+		RequesterID: requesterID,
+		TargetID:    user.ID,
+	})
+	if err != nil {
+		fmt.Println("error deleting follow request: ", err)
+		respondWithError(w, 500, "failed to accept follow request")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "no follow request found from this user")
+		return
+	}
+	_, err = cfg.addFollow(r.Context(), qtx, requesterID, &user)
+	if err != nil {
+		fmt.Println("error creating follow: ", err)
+		respondWithError(w, 500, "failed to accept follow request")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing follow: ", err)
+		respondWithError(w, 500, "failed to accept follow request")
+		return
+	}
+
+	cfg.notify(r.Context(), notification{
+		recipient: requesterID,
+		actor:     user.ID,
+		kind:      notificationFollowAccepted,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rejectFollowRequest drops a request, the requester isn't told
+func (cfg *apiConfig) rejectFollowRequest(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	requesterID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeleteFollowRequest(r.Context(), database.DeleteFollowRequestParams{
+		RequesterID: requesterID,
+		TargetID:    user.ID,
+	})
+	if err != nil {
+		fmt.Println("error deleting follow request: ", err)
+		respondWithError(w, 500, "failed to reject follow request")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "no follow request found from this user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// acceptAllFollowRequests accepts every request waiting on target and
+// returns who sent them, for when the account stops being protected
+func (cfg *apiConfig) acceptAllFollowRequests(ctx context.Context, qtx *database.Queries, target *database.User) ([]uuid.UUID, error) {
+	requesterIDs, err := qtx.GetFollowRequesterIDs(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, requesterID := range requesterIDs {
+		_, err = qtx.DeleteFollowRequest(ctx, database.DeleteFollowRequestParams{
+			RequesterID: requesterID,
+			TargetID:    target.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = cfg.addFollow(ctx, qtx, requesterID, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return requesterIDs, nil
+}
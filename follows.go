@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// UserSummary is what other people get to see about a user in lists, unlike
+// User it doesn't carry the email
+type UserSummary struct {
+	ID         uuid.UUID  `json:"id"`
+	Handle     string     `json:"handle"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FollowedAt *time.Time `json:"followed_at,omitempty"`
+	BlockedAt  *time.Time `json:"blocked_at,omitempty"`
+	MutedAt    *time.Time `json:"muted_at,omitempty"`
+	// for follow requests waiting on a protected account
+	RequestedAt *time.Time `json:"requested_at,omitempty"`
+}
+
+type FollowList struct {
+	Total int64         `json:"total"`
+	Users []UserSummary `json:"users"`
+}
+
+// followUser follows a user. Following a protected account only asks to:
+// the request waits for its owner and the response is 202 instead of 204.
+func (cfg *apiConfig) followUser(w http.ResponseWriter, r *http.Request) {
+	follower, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if followeeID == follower.ID {
+		respondWithError(w, 400, "you can't follow yourself")
+		return
+	}
+
+	followee, err := cfg.dbQueries.GetUserByID(r.Context(), followeeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no user found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching user: ", err)
+		respondWithError(w, 500, "failed to follow user")
+		return
+	}
+
+	blocked, err := cfg.blockedBetween(r.Context(), follower.ID, followeeID)
+	if err != nil {
+		fmt.Println("error checking blocks: ", err)
+		respondWithError(w, 500, "failed to follow user")
+		return
+	}
+	if blocked {
+		respondWithError(w, 403, "you can't follow this user")
+		return
+	}
+
+	if followee.Protected {
+		cfg.requestFollow(w, r, follower.ID, &followee)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to follow user")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	created, err := cfg.addFollow(r.Context(), qtx, follower.ID, &followee)
+	if err != nil {
+		fmt.Println("error creating follow: ", err)
+		respondWithError(w, 500, "failed to follow user")
+		return
+	}
+	// already following, nothing else to do
+	if !created {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing follow: ", err)
+		respondWithError(w, 500, "failed to follow user")
+		return
+	}
+
+	cfg.notify(r.Context(), notification{
+		recipient: followeeID,
+		actor:     follower.ID,
+		kind:      notificationFollow,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addFollow creates a follow along with what hangs off it, the opposite of
+// removeFollow. It's false when the follow was already there.
+func (cfg *apiConfig) addFollow(ctx context.Context, qtx *database.Queries, follower uuid.UUID, followee *database.User) (bool, error) {
+	created, err := qtx.CreateFollow(ctx, database.CreateFollowParams{
+		FollowerID: follower,
+		FolloweeID: followee.ID,
+	})
+	if err != nil || created == 0 {
+		return false, err
+	}
+
+	err = qtx.AddToFollowerCount(ctx, database.AddToFollowerCountParams{
+		Delta: 1,
+		ID:    followee.ID,
+	})
+	if err != nil {
+		return false, err
+	}
+	// large accounts are merged in at read time, everyone else's recent
+	// chirps are copied in so the timeline isn't missing them
+	if followee.FollowerCount < cfg.fanoutThreshold {
+		err = qtx.BackfillTimeline(ctx, database.BackfillTimelineParams{
+			UserID:     follower,
+			AuthorID:   followee.ID,
+			MaxEntries: followBackfillSize,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// unfollowUser stops following a user, or withdraws a follow request that's
+// still waiting
+func (cfg *apiConfig) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	follower, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to unfollow user")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = removeFollow(r.Context(), qtx, follower.ID, followeeID)
+	if err == nil {
+		_, err = qtx.DeleteFollowRequest(r.Context(), database.DeleteFollowRequestParams{
+			RequesterID: follower.ID,
+			TargetID:    followeeID,
+		})
+	}
+	if err != nil {
+		fmt.Println("error deleting follow: ", err)
+		respondWithError(w, 500, "failed to unfollow user")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing unfollow: ", err)
+		respondWithError(w, 500, "failed to unfollow user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) getFollowers(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if cfg.respondIfBlocked(w, r, viewer, userID, "no user found with the requested ID") {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	total, err := cfg.dbQueries.CountFollowers(r.Context(), userID)
+	if err != nil {
+		fmt.Println("error counting followers: ", err)
+		respondWithError(w, 500, "failed to fetch followers")
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetFollowers(r.Context(), database.GetFollowersParams{
+		FolloweeID: userID,
+		ViewerID:   viewer,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching followers: ", err)
+		respondWithError(w, 500, "failed to fetch followers")
+		return
+	}
+
+	resp := FollowList{Total: total, Users: []UserSummary{}}
+	for i := range rows {
+		resp.Users = append(resp.Users, UserSummary{
+			ID:         rows[i].ID,
+			Handle:     rows[i].Handle,
+			CreatedAt:  rows[i].CreatedAt,
+			FollowedAt: &rows[i].FollowedAt,
+		})
+	}
+	respondWithJSON(w, 200, resp)
+}
+
+func (cfg *apiConfig) getFollowing(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if cfg.respondIfBlocked(w, r, viewer, userID, "no user found with the requested ID") {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	total, err := cfg.dbQueries.CountFollowing(r.Context(), userID)
+	if err != nil {
+		fmt.Println("error counting followed users: ", err)
+		respondWithError(w, 500, "failed to fetch followed users")
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetFollowing(r.Context(), database.GetFollowingParams{
+		FollowerID: userID,
+		ViewerID:   viewer,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching followed users: ", err)
+		respondWithError(w, 500, "failed to fetch followed users")
+		return
+	}
+
+	resp := FollowList{Total: total, Users: []UserSummary{}}
+	for i := range rows {
+		resp.Users = append(resp.Users, UserSummary{
+			ID:         rows[i].ID,
+			Handle:     rows[i].Handle,
+			CreatedAt:  rows[i].CreatedAt,
+			FollowedAt: &rows[i].FollowedAt,
+		})
+	}
+	respondWithJSON(w, 200, resp)
+}
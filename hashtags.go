@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+)
+
+// trending is worked out from the sliding window cfg.trendingWindow: each tag's
+// uses in the last window are compared with its uses in the window before,
+// and the tags that grew the most are trending. The counts are recomputed
+// into trending_hashtags every trendingRefreshInterval.
+
+const (
+	trendingRefreshInterval = 5 * time.Minute
+	// a tag needs this many uses in the current window to trend at all, so a
+	// single chirp can't put something on the list
+	trendingMinUses = 3
+)
+
+type TrendingTag struct {
+	Tag          string `json:"tag"`
+	Uses         int32  `json:"uses"`
+	PreviousUses int32  `json:"previous_uses"`
+	// uses per hour over the current window
+	Velocity float64 `json:"velocity"`
+}
+
+type TrendingTags struct {
+	Window      string        `json:"window"`
+	RefreshedAt *time.Time    `json:"refreshed_at,omitempty"`
+	Tags        []TrendingTag `json:"tags"`
+}
+
+// saveHashtags replaces the stored tags of a chirp with the ones in its
+// current body
+func saveHashtags(ctx context.Context, qtx *database.Queries, chrp *database.Chirp) error {
+	err := qtx.DeleteChirpHashtags(ctx, chrp.ID)
+	if err != nil {
+		return err
+	}
+	tags := chirptext.Hashtags(chrp.Body)
+	if len(tags) == 0 {
+		return nil
+	}
+	return qtx.CreateChirpHashtags(ctx, database.CreateChirpHashtagsParams{
+		ChirpID:   chrp.ID,
+		CreatedAt: chrp.CreatedAt,
+		Tags:      tags,
+	})
+}
+
+// getHashtagChirps lists the chirps with a tag, newest first. The tag can be
+// given with or without the #, in any case.
+func (cfg *apiConfig) getHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	tag := strings.TrimLeft(r.PathValue("tag"), "#＃")
+	if tag == "" {
+		respondWithError(w, 400, "invalid hashtag")
+		return
+	}
+
+	limit, after, err := parseKeysetPagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	dbChirps, err := cfg.dbQueries.GetHashtagChirps(r.Context(), database.GetHashtagChirpsParams{
+		Tag:             chirptext.NormalizeHashtag(tag),
+		BeforeCreatedAt: after.CreatedAt,
+		BeforeID:        after.ID,
+		ViewerID:        viewer,
+		PageLimit:       limit,
+	})
+	if err != nil {
+		fmt.Println("error fetching hashtag chirps: ", err)
+		respondWithError(w, 500, "failed to fetch chirps")
+		return
+	}
+
+	cfg.respondWithChirpPage(w, r, viewer, dbChirps, limit)
+}
+
+// getTrendingHashtags serves the last computed trending list, fastest growing
+// tag first
+func (cfg *apiConfig) getTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	trending, err := cfg.dbQueries.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching trending hashtags: ", err)
+		respondWithError(w, 500, "failed to fetch trending hashtags")
+		return
+	}
+
+	resp := TrendingTags{Window: cfg.trendingWindow.String(), Tags: []TrendingTag{}}
+	for i := range trending {
+		resp.RefreshedAt = &trending[i].RefreshedAt
+		resp.Tags = append(resp.Tags, TrendingTag{
+			Tag:          trending[i].Tag,
+			Uses:         trending[i].Uses,
+			PreviousUses: trending[i].PreviousUses,
+			Velocity:     float64(trending[i].Uses) / cfg.trendingWindow.Hours(),
+		})
+	}
+	respondWithJSON(w, 200, resp)
+}
+
+// refreshTrendingHashtags recomputes trending_hashtags in one transaction, so
+// readers see either the old list or the new one
+func (cfg *apiConfig) refreshTrendingHashtags(ctx context.Context) (int64, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.ClearTrendingHashtags(ctx)
+	if err != nil {
+		return 0, err
+	}
+	windowStart := time.Now().UTC().Add(-cfg.trendingWindow)
+	tags, err := qtx.RefreshTrendingHashtags(ctx, database.RefreshTrendingHashtagsParams{
+		WindowStart:         windowStart,
+		PreviousWindowStart: windowStart.Add(-cfg.trendingWindow),
+		MinUses:             trendingMinUses,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return tags, tx.Commit()
+}
+
+// runTrendingRefresher refreshes the trending hashtags once every
+// trendingRefreshInterval until ctx is done
+func (cfg *apiConfig) runTrendingRefresher(ctx context.Context) {
+	ticker := time.NewTicker(trendingRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := cfg.refreshTrendingHashtags(ctx)
+		if err != nil {
+			log.Printf("error refreshing trending hashtags: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reindexHashtags extracts the tags of every chirp again, for chirps from
+// before tags were stored or after the extraction rules change. That's every
+// chirp not deleted, not just the ones in the public listing: the tag pages
+// show the rest to whoever can see them.
+func (cfg *apiConfig) reindexHashtags(ctx context.Context) (int, error) {
+	dbChirps, err := cfg.dbQueries.GetChirpsToReindex(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := range dbChirps {
+		err = saveHashtags(ctx, cfg.dbQueries, &dbChirps[i])
+		if err != nil {
+			return i, fmt.Errorf("chirp %s: %w", dbChirps[i].ID, err)
+		}
+	}
+	return len(dbChirps), nil
+}
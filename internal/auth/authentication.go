@@ -49,10 +49,31 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userID, err := claims.GetSubject()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid subject: %w", err)
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user id: %w", err)
+	}
+	return userUUID, nil
+}
+
+// ParseJWT does the signature, expiry and issuer checks of ValidateJWT but
+// hands back the whole claim set, for callers that need more than the subject
+// (e.g. token introspection)
+func ParseJWT(tokenString, tokenSecret string) (*CustomClaims, error) {
 	// Validate JWT format
 	parts := strings.Split(tokenString, ".")
 	if len(parts) != 3 {
-		return uuid.Nil, fmt.Errorf("invalid JWT: must have 3 parts")
+		return nil, fmt.Errorf("invalid JWT: must have 3 parts")
 	}
 
 	// Parse token
@@ -66,34 +87,24 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		// Debug header on error
 		header, decodeErr := base64.RawURLEncoding.DecodeString(parts[0])
 		if decodeErr != nil {
-			return uuid.Nil, fmt.Errorf("failed to decode header: %w", err)
+			return nil, fmt.Errorf("failed to decode header: %w", err)
 		}
-		return uuid.Nil, fmt.Errorf("failed to parse token: %w, header: %s", err, string(header))
+		return nil, fmt.Errorf("failed to parse token: %w, header: %s", err, string(header))
 	}
 
 	// Validate claims and token
 	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		userID, err := claims.GetSubject()
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("invalid subject: %w", err)
-		}
-
 		issuer, err := claims.GetIssuer()
 		if err != nil {
-			return uuid.Nil, fmt.Errorf("invalid issuer: %w", err)
+			return nil, fmt.Errorf("invalid issuer: %w", err)
 		}
 		if issuer != "chirpy" {
-			return uuid.Nil, errors.New("invalid issuer")
-		}
-
-		userUUID, err := uuid.Parse(userID)
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("invalid user id: %w", err)
+			return nil, errors.New("invalid issuer")
 		}
-		return userUUID, nil
+		return claims, nil
 	}
 
-	return uuid.Nil, errors.New("invalid claims or token")
+	return nil, errors.New("invalid claims or token")
 }
 
 // untested
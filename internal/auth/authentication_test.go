@@ -111,3 +111,56 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestParseJWT(t *testing.T) {
+	userID := uuid.New()
+	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	expiredToken, _ := MakeJWT(userID, "secret", -time.Minute)
+
+	tests := []struct {
+		name        string
+		tokenString string
+		tokenSecret string
+		wantSubject string
+		wantErr     bool
+	}{
+		{
+			name:        "Valid token",
+			tokenString: validToken,
+			tokenSecret: "secret",
+			wantSubject: userID.String(),
+			wantErr:     false,
+		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			tokenSecret: "secret",
+			wantErr:     true,
+		},
+		{
+			name:        "Wrong secret",
+			tokenString: validToken,
+			tokenSecret: "wrong_secret",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseJWT(tt.tokenString, tt.tokenSecret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseJWT() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if claims.Subject != tt.wantSubject {
+				t.Errorf("ParseJWT() subject = %v, want %v", claims.Subject, tt.wantSubject)
+			}
+			if claims.ExpiresAt == nil || claims.IssuedAt == nil {
+				t.Errorf("ParseJWT() missing exp/iat claims")
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package chirptext
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxHashtagLength is the longest tag (in runes, without the #) that's
+// picked up, anything longer is left as plain text
+const MaxHashtagLength = 100
+
+var folder = cases.Fold()
+
+// Hashtags returns the tags in a chirp body, normalized and without
+// duplicates, in the order they first appear.
+//
+// A tag is a # (or the fullwidth ＃) followed by letters, marks, digits,
+// underscores or the zero width joiners some scripts need, with at least one
+// letter in it, so "#1" is not a tag. The # can't come straight after a word
+// character, an & or another #, which keeps "a#b", "&#39;" and "##" out. Tags
+// inside URLs don't count.
+func Hashtags(body string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		tags = appendHashtags(tags, seen, body[last:loc[0]])
+		last = loc[1]
+	}
+	return appendHashtags(tags, seen, body[last:])
+}
+
+func appendHashtags(tags []string, seen map[string]bool, text string) []string {
+	prev := rune(-1)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if (r == '#' || r == '＃') && !blocksHashtag(prev) {
+			end, hasLetter := i+size, false
+			for end < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[end:])
+				if !isHashtagRune(next) {
+					break
+				}
+				hasLetter = hasLetter || unicode.IsLetter(next)
+				end += nextSize
+			}
+			raw := text[i+size : end]
+			if hasLetter && utf8.RuneCountInString(raw) <= MaxHashtagLength {
+				tag := NormalizeHashtag(raw)
+				if !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+			if end > i+size {
+				prev, _ = utf8.DecodeLastRuneInString(text[:end])
+				i = end
+				continue
+			}
+		}
+		prev = r
+		i += size
+	}
+	return tags
+}
+
+// NormalizeHashtag is the form tags are stored and looked up in: compatibility
+// characters unified (fullwidth letters, ligatures) and case folded, so
+// #Go, #GO and #Ｇｏ are all the same tag
+func NormalizeHashtag(tag string) string {
+	return norm.NFC.String(folder.String(norm.NFKC.String(tag)))
+}
+
+func isHashtagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) ||
+		r == '_' || r == '\u200c' || r == '\u200d'
+}
+
+func blocksHashtag(prev rune) bool {
+	return prev == '&' || prev == '#' || prev == '＃' || (prev != -1 && isHashtagRune(prev))
+}
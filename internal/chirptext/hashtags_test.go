@@ -0,0 +1,80 @@
+package chirptext
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "Simple",
+			body: "learning #golang today",
+			want: []string{"golang"},
+		},
+		{
+			name: "Case folded and deduplicated",
+			body: "#Go #GO #go",
+			want: []string{"go"},
+		},
+		{
+			name: "Fullwidth hash and letters",
+			body: "＃Ｇｏ",
+			want: []string{"go"},
+		},
+		{
+			name: "Non latin scripts",
+			body: "#日本語 #кофе #café",
+			want: []string{"日本語", "кофе", "café"},
+		},
+		{
+			name: "Punctuation ends a tag",
+			body: "#chirpy, #go!",
+			want: []string{"chirpy", "go"},
+		},
+		{
+			name: "Underscores and digits",
+			body: "#go_1_24",
+			want: []string{"go_1_24"},
+		},
+		{
+			name: "Only digits is not a tag",
+			body: "we're #1",
+			want: nil,
+		},
+		{
+			name: "Not after a word character",
+			body: "a#b c&#39;s ##double",
+			want: nil,
+		},
+		{
+			name: "Not inside a URL",
+			body: "https://example.com/#anchor but #this",
+			want: []string{"this"},
+		},
+		{
+			name: "Too long",
+			body: "#" + strings.Repeat("a", MaxHashtagLength+1),
+			want: nil,
+		},
+		{
+			name: "Back to back",
+			body: "#one#two",
+			want: []string{"one"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Hashtags(tc.body)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Hashtags(%q) = %q, want %q", tc.body, got, tc.want)
+			}
+		})
+	}
+}
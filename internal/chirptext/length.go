@@ -0,0 +1,28 @@
+package chirptext
+
+import (
+	"regexp"
+
+	"github.com/rivo/uniseg"
+)
+
+// URLWeight is what a link counts for no matter how long it actually is, so
+// people aren't punished for long URLs
+const URLWeight = 23
+
+var urlPattern = regexp.MustCompile(`https?://[^\s]+`)
+
+// Length returns the length of a chirp body as users see it: every grapheme
+// cluster (an emoji with skin tone, a letter with combining accents...) counts
+// as one, and every URL counts as URLWeight.
+func Length(body string) int {
+	length := 0
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		length += uniseg.GraphemeClusterCount(body[last:loc[0]])
+		length += URLWeight
+		last = loc[1]
+	}
+	length += uniseg.GraphemeClusterCount(body[last:])
+	return length
+}
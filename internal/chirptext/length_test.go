@@ -0,0 +1,53 @@
+package chirptext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{
+			name: "Plain ASCII",
+			body: "hello chirpy",
+			want: 12,
+		},
+		{
+			name: "Emoji count as one each",
+			body: strings.Repeat("🐦", 50),
+			want: 50,
+		},
+		{
+			name: "Emoji with skin tone modifier",
+			body: "👍🏽",
+			want: 1,
+		},
+		{
+			name: "Combining accent",
+			body: "é",
+			want: 1,
+		},
+		{
+			name: "URL has a fixed weight",
+			body: "look https://example.com/a/really/long/path/that/goes/on?and=on",
+			want: 5 + URLWeight,
+		},
+		{
+			name: "Empty",
+			body: "",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Length(tt.body); got != tt.want {
+				t.Errorf("Length() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
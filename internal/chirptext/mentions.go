@@ -0,0 +1,101 @@
+package chirptext
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MinHandleLength = 3
+	MaxHandleLength = 15
+)
+
+// Mention is an @handle found in a chirp body. Start and End are offsets in
+// Unicode code points (not bytes), End is exclusive and the span includes
+// the @.
+type Mention struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+// ValidateHandle checks a handle is MinHandleLength to MaxHandleLength ASCII
+// letters, digits and underscores
+func ValidateHandle(handle string) error {
+	if len(handle) < MinHandleLength || len(handle) > MaxHandleLength {
+		return fmt.Errorf("handle must be between %d and %d characters", MinHandleLength, MaxHandleLength)
+	}
+	for i := 0; i < len(handle); i++ {
+		if !isHandleByte(handle[i]) {
+			return fmt.Errorf("handle can only contain letters, digits and underscores")
+		}
+	}
+	return nil
+}
+
+// NormalizeHandle is the form handles are compared in, they're unique
+// regardless of case
+func NormalizeHandle(handle string) string {
+	return strings.ToLower(handle)
+}
+
+// Mentions returns every @handle in a chirp body, in order. Like hashtags the
+// @ can't follow a word character (so emails don't count) and mentions inside
+// URLs are skipped. Something that's too long to be a handle isn't a mention.
+func Mentions(body string) []Mention {
+	var mentions []Mention
+	last, runes := 0, 0
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		mentions = appendMentions(mentions, body[last:loc[0]], runes)
+		runes += utf8.RuneCountInString(body[last:loc[1]])
+		last = loc[1]
+	}
+	return appendMentions(mentions, body[last:], runes)
+}
+
+func appendMentions(mentions []Mention, text string, offset int) []Mention {
+	prev := rune(-1)
+	runeIndex := offset
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == '@' && !isHandleRune(prev) && prev != '@' {
+			end := i + size
+			for end < len(text) && isHandleByte(text[end]) {
+				end++
+			}
+			handle := text[i+size : end]
+			// a longer run means it's not a handle, not that it's a shorter one
+			if end > i+size && len(handle) <= MaxHandleLength {
+				mentions = append(mentions, Mention{
+					Handle: handle,
+					Start:  runeIndex,
+					End:    runeIndex + 1 + len(handle),
+				})
+			}
+			if end > i+size {
+				runeIndex += 1 + len(handle)
+				prev = rune(text[end-1])
+				i = end
+				continue
+			}
+		}
+		prev = r
+		runeIndex++
+		i += size
+	}
+	return mentions
+}
+
+func isHandleByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// isHandleRune also stops mentions straight after any other letter, so
+// "é@x" isn't one either
+func isHandleRune(r rune) bool {
+	if r >= 0 && r < utf8.RuneSelf {
+		return isHandleByte(byte(r))
+	}
+	return isHashtagRune(r)
+}
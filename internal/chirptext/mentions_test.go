@@ -0,0 +1,80 @@
+package chirptext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Mention
+	}{
+		{
+			name: "Simple",
+			body: "hi @alice",
+			want: []Mention{{Handle: "alice", Start: 3, End: 9}},
+		},
+		{
+			name: "Offsets count code points",
+			body: "🐦 @bob and @carol_1!",
+			want: []Mention{
+				{Handle: "bob", Start: 2, End: 6},
+				{Handle: "carol_1", Start: 11, End: 19},
+			},
+		},
+		{
+			name: "Emails are not mentions",
+			body: "mail me at bob@example.com",
+			want: nil,
+		},
+		{
+			name: "Too long is not a mention",
+			body: "@abcdefghijklmnopqrstuvwxyz",
+			want: nil,
+		},
+		{
+			name: "Not inside a URL",
+			body: "https://example.com/@bob then @dave",
+			want: []Mention{{Handle: "dave", Start: 30, End: 35}},
+		},
+		{
+			name: "Bare @",
+			body: "@ @@ @",
+			want: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Mentions(tc.body)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Mentions(%q) = %+v, want %+v", tc.body, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateHandle(t *testing.T) {
+	tests := []struct {
+		handle  string
+		wantErr bool
+	}{
+		{handle: "alice", wantErr: false},
+		{handle: "Bob_42", wantErr: false},
+		{handle: "ab", wantErr: true},
+		{handle: "abcdefghijklmnop", wantErr: true},
+		{handle: "with space", wantErr: true},
+		{handle: "café", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.handle, func(t *testing.T) {
+			err := ValidateHandle(tc.handle)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("ValidateHandle(%q) error = %v, wantErr %v", tc.handle, err, tc.wantErr)
+			}
+		})
+	}
+}
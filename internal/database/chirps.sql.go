@@ -7,29 +7,127 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countQuotes = `-- name: CountQuotes :many
+SELECT quote_of, COUNT(*) AS quote_count FROM chirps
+WHERE quote_of = ANY($1::uuid[]) AND deleted_at IS NULL
+GROUP BY quote_of
+`
+
+type CountQuotesRow struct {
+	QuoteOf    uuid.NullUUID
+	QuoteCount int64
+}
+
+func (q *Queries) CountQuotes(ctx context.Context, chirpIds []uuid.UUID) ([]CountQuotesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countQuotes, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountQuotesRow
+	for rows.Next() {
+		var i CountQuotesRow
+		if err := rows.Scan(
+			&i.QuoteOf,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countReplies = `-- name: CountReplies :many
+SELECT in_reply_to, COUNT(*) AS reply_count FROM chirps
+WHERE in_reply_to = ANY($1::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to
+`
+
+type CountRepliesRow struct {
+	InReplyTo  uuid.NullUUID
+	ReplyCount int64
+}
+
+func (q *Queries) CountReplies(ctx context.Context, chirpIds []uuid.UUID) ([]CountRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countReplies, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountRepliesRow
+	for rows.Next() {
+		var i CountRepliesRow
+		if err := rows.Scan(
+			&i.InReplyTo,
+			&i.ReplyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, flagged_at, flag_reason, in_reply_to, root_id, quote_of, visibility)
     VALUES (
         gen_random_uuid(),
         NOW(),
         NOW(),
         $1,
-        $2
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        $8
     )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body       string
+	UserID     uuid.UUID
+	FlaggedAt  sql.NullTime
+	FlagReason sql.NullString
+	InReplyTo  uuid.NullUUID
+	RootID     uuid.NullUUID
+	QuoteOf    uuid.NullUUID
+	Visibility string
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.FlaggedAt,
+		arg.FlagReason,
+		arg.InReplyTo,
+		arg.RootID,
+		arg.QuoteOf,
+		arg.Visibility,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,17 +135,87 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.FlaggedAt,
+		&i.FlagReason,
+		&i.DeletedAt,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.QuoteOf,
+		&i.Visibility,
 	)
 	return i, err
 }
 
+const deleteChirp = `-- name: DeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+	return err
+}
+
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility FROM chirps
+WHERE deleted_at IS NULL AND NOT blocked_between(user_id, $1)
+  AND visibility <> 'unlisted'
+  AND can_view_chirp(id, user_id, visibility, $1)
+ORDER BY created_at ASC
+`
+
+// unlisted chirps stay out, like in every public listing
+func (q *Queries) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirps, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.FlaggedAt,
+			&i.FlagReason,
+			&i.DeletedAt,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.QuoteOf,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.flagged_at, parent.flag_reason, parent.deleted_at, parent.in_reply_to, parent.root_id, parent.quote_of, parent.visibility FROM chirps AS parent
+    WHERE parent.id = (SELECT c.in_reply_to FROM chirps AS c WHERE c.id = $1)
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged_at, chirps.flag_reason, chirps.deleted_at, chirps.in_reply_to, chirps.root_id, chirps.quote_of, chirps.visibility FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to
+)
+SELECT id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility FROM ancestors
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +229,13 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.FlaggedAt,
+			&i.FlagReason,
+			&i.DeletedAt,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.QuoteOf,
+			&i.Visibility,
 		); err != nil {
 			return nil, err
 		}
@@ -76,7 +251,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility FROM chirps
 WHERE chirps.id = $1
 `
 
@@ -89,6 +264,359 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.FlaggedAt,
+		&i.FlagReason,
+		&i.DeletedAt,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.QuoteOf,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const getChirpByIDForUpdate = `-- name: GetChirpByIDForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility FROM chirps
+WHERE chirps.id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpByIDForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIDForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.FlaggedAt,
+		&i.FlagReason,
+		&i.DeletedAt,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.QuoteOf,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const getChirpReplies = `-- name: GetChirpReplies :many
+WITH RECURSIVE thread AS (
+    SELECT top.id, 1 AS depth FROM (
+        SELECT chirps.id FROM chirps
+        WHERE chirps.in_reply_to = $1
+          AND NOT blocked_between(chirps.user_id, $2)
+          AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, $2)
+        ORDER BY chirps.created_at ASC
+        LIMIT $3 OFFSET $4
+    ) AS top
+    UNION ALL
+    SELECT chirps.id, thread.depth + 1 FROM chirps
+    JOIN thread ON chirps.in_reply_to = thread.id
+    WHERE thread.depth < $5::int
+      AND NOT blocked_between(chirps.user_id, $2)
+      AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, $2)
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged_at, chirps.flag_reason, chirps.deleted_at, chirps.in_reply_to, chirps.root_id, chirps.quote_of, chirps.visibility, thread.depth FROM thread
+JOIN chirps ON chirps.id = thread.id
+ORDER BY thread.depth ASC, chirps.created_at ASC
+`
+
+type GetChirpRepliesParams struct {
+	ChirpID    uuid.NullUUID
+	ViewerID   uuid.UUID
+	PageLimit  int32
+	PageOffset int32
+	MaxDepth   int32
+}
+
+type GetChirpRepliesRow struct {
+	Chirp Chirp
+	Depth int32
+}
+
+// the replies under a chirp down to max_depth levels, only the direct
+// replies are paginated and each one comes with its whole subtree. Replies by
+// someone blocked either way, or that the viewer isn't allowed to see, are
+// left out along with everything under them.
+func (q *Queries) GetChirpReplies(ctx context.Context, arg GetChirpRepliesParams) ([]GetChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpReplies,
+		arg.ChirpID,
+		arg.ViewerID,
+		arg.PageLimit,
+		arg.PageOffset,
+		arg.MaxDepth,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpRepliesRow
+	for rows.Next() {
+		var i GetChirpRepliesRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.FlaggedAt,
+			&i.Chirp.FlagReason,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.RootID,
+			&i.Chirp.QuoteOf,
+			&i.Chirp.Visibility,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.FlaggedAt,
+			&i.FlagReason,
+			&i.DeletedAt,
+			&i.InReplyTo,
+			&i.RootID,
+			&i.QuoteOf,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserChirps = `-- name: GetUserChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.flagged_at, chirps.flag_reason, chirps.deleted_at, chirps.in_reply_to, chirps.root_id, chirps.quote_of, chirps.visibility, feed.rechirped_by, feed.activity_at FROM (
+    SELECT own.id AS chirp_id, NULL::uuid AS rechirped_by, own.created_at AS activity_at
+    FROM chirps AS own
+    WHERE own.user_id = $1
+    UNION ALL
+    SELECT rechirps.chirp_id, rechirps.user_id, rechirps.created_at
+    FROM rechirps
+    WHERE rechirps.user_id = $1
+) AS feed
+JOIN chirps ON chirps.id = feed.chirp_id
+WHERE chirps.deleted_at IS NULL
+  AND NOT blocked_between(chirps.user_id, $2)
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, $2)
+ORDER BY feed.activity_at DESC
+LIMIT $3 OFFSET $4
+`
+
+type GetUserChirpsParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+	Limit    int32
+	Offset   int32
+}
+
+type GetUserChirpsRow struct {
+	Chirp       Chirp
+	RechirpedBy uuid.NullUUID
+	ActivityAt  time.Time
+}
+
+// a user's own chirps and their rechirps, newest activity first
+func (q *Queries) GetUserChirps(ctx context.Context, arg GetUserChirpsParams) ([]GetUserChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserChirps,
+		arg.UserID,
+		arg.ViewerID,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserChirpsRow
+	for rows.Next() {
+		var i GetUserChirpsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.FlaggedAt,
+			&i.Chirp.FlagReason,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.RootID,
+			&i.Chirp.QuoteOf,
+			&i.Chirp.Visibility,
+			&i.RechirpedBy,
+			&i.ActivityAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getViewableChirpIDs = `-- name: GetViewableChirpIDs :many
+SELECT chirps.id FROM chirps
+WHERE chirps.id = ANY($1::uuid[])
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, $2)
+`
+
+type GetViewableChirpIDsParams struct {
+	Ids      []uuid.UUID
+	ViewerID uuid.UUID
+}
+
+// which of the given chirps the viewer is allowed to see, blocks aside
+func (q *Queries) GetViewableChirpIDs(ctx context.Context, arg GetViewableChirpIDsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getViewableChirpIDs, pq.Array(arg.Ids), arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var column_1 uuid.UUID
+		if err := rows.Scan(&column_1); err != nil {
+			return nil, err
+		}
+		items = append(items, column_1)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at > $2
+RETURNING id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility
+`
+
+type RestoreChirpParams struct {
+	ID        uuid.UUID
+	DeletedAt sql.NullTime
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.DeletedAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.FlaggedAt,
+		&i.FlagReason,
+		&i.DeletedAt,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.QuoteOf,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $1,
+    updated_at = NOW(),
+    flagged_at = COALESCE($2, flagged_at),
+    flag_reason = COALESCE($3, flag_reason)
+WHERE id = $4
+RETURNING id, created_at, updated_at, body, user_id, flagged_at, flag_reason, deleted_at, in_reply_to, root_id, quote_of, visibility
+`
+
+type UpdateChirpParams struct {
+	Body       string
+	FlaggedAt  sql.NullTime
+	FlagReason sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp,
+		arg.Body,
+		arg.FlaggedAt,
+		arg.FlagReason,
+		arg.ID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.FlaggedAt,
+		&i.FlagReason,
+		&i.DeletedAt,
+		&i.InReplyTo,
+		&i.RootID,
+		&i.QuoteOf,
+		&i.Visibility,
 	)
 	return i, err
 }
@@ -5,17 +5,247 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Attachment struct {
+	ID                   uuid.UUID
+	UserID               uuid.UUID
+	CreatedAt            time.Time
+	ContentType          string
+	SizeBytes            int32
+	Width                int32
+	Height               int32
+	StorageKey           string
+	ThumbnailKey         string
+	ThumbnailContentType string
+	ChirpID              uuid.NullUUID
+	Position             sql.NullInt32
+	AltText              string
+	ScheduledChirpID     uuid.NullUUID
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	FlaggedAt  sql.NullTime
+	FlagReason sql.NullString
+	DeletedAt  sql.NullTime
+	InReplyTo  uuid.NullUUID
+	RootID     uuid.NullUUID
+	QuoteOf    uuid.NullUUID
+	Visibility string
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	Handle    string
+	CreatedAt time.Time
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type Conversation struct {
+	ID            uuid.UUID
+	DirectKey     sql.NullString
+	CreatedBy     uuid.NullUUID
+	CreatedAt     time.Time
+	LastMessageAt time.Time
+}
+
+type ConversationMember struct {
+	ConversationID    uuid.UUID
+	UserID            uuid.UUID
+	JoinedAt          time.Time
+	LastReadMessageID uuid.NullUUID
+	LastReadAt        sql.NullTime
+}
+
+type Draft struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	Visibility  string
+	InReplyTo   uuid.NullUUID
+	QuoteOf     uuid.NullUUID
+	Attachments json.RawMessage
+	Poll        json.RawMessage
+}
+
+type FanoutQueue struct {
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+	Attempts  int32
+	FailedAt  sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type FollowRequest struct {
+	RequesterID uuid.UUID
+	TargetID    uuid.UUID
+	CreatedAt   time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Message struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+	CreatedAt      time.Time
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
 	ID        uuid.UUID
+	UserID    uuid.UUID
+	Type      string
+	ChirpID   uuid.NullUUID
+	GroupKey  string
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Body      string
+	ReadAt    sql.NullTime
+}
+
+type NotificationActor struct {
+	NotificationID uuid.UUID
+	ActorID        uuid.UUID
+	CreatedAt      time.Time
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID
+	Type    string
+	Enabled bool
+}
+
+type Poll struct {
+	ChirpID  uuid.UUID
+	ClosesAt time.Time
+	ClosedAt sql.NullTime
+}
+
+type PollOption struct {
+	ChirpID  uuid.UUID
+	Position int32
+	Text     string
+}
+
+type PollVote struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	Position  int32
+	CreatedAt time.Time
+}
+
+type Rechirp struct {
 	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	Token     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+}
+
+type Report struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ChirpID    uuid.NullUUID
+	ReporterID uuid.NullUUID
+	Reason     string
+	Status     string
+	ClaimedBy  uuid.NullUUID
+	ClaimedAt  sql.NullTime
+	Resolution sql.NullString
+	ResolvedBy uuid.NullUUID
+	ResolvedAt sql.NullTime
+}
+
+type ReportDecision struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	ReportID    uuid.UUID
+	ModeratorID uuid.NullUUID
+	Action      string
+	Note        string
+}
+
+type ScheduledChirp struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	PublishAt    time.Time
+	Body         string
+	Visibility   string
+	InReplyTo    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+	FailedReason sql.NullString
+	Poll         json.RawMessage
+}
+
+type TimelineEntry struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	AuthorID  uuid.UUID
+	CreatedAt time.Time
+}
+
+type TrendingHashtag struct {
+	Tag          string
+	Uses         int32
+	PreviousUses int32
+	RefreshedAt  time.Time
 }
 
 type User struct {
@@ -24,4 +254,9 @@ type User struct {
 	UpdatedAt      time.Time
 	Email          string
 	HashedPassword string
+	SuspendedAt    sql.NullTime
+	IsAdmin        bool
+	FollowerCount  int32
+	Handle         string
+	Protected      bool
 }
@@ -0,0 +1,97 @@
+// Package media checks and prepares uploaded images: what they really are
+// (never what the client says), without the metadata cameras and phones put
+// in them, and with a small copy for listings.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeGIF  = "image/gif"
+)
+
+// MaxPixels caps width*height, a few kilobytes of compressed image can claim
+// to be big enough to run the server out of memory once decoded
+const MaxPixels = 25_000_000
+
+var ErrUnsupported = errors.New("unsupported file type, upload a JPEG, PNG or GIF")
+
+// Image is an upload ready to be stored
+type Image struct {
+	ContentType string
+	// the upload minus its metadata
+	Data   []byte
+	Width  int
+	Height int
+
+	Thumbnail     []byte
+	ThumbnailType string
+}
+
+// Process sniffs data, strips its metadata and makes its thumbnail. A JPEG
+// that relies on its EXIF orientation is turned the right way up first,
+// stripping would lose the orientation otherwise. Only the first frame of an
+// animated GIF makes it into the thumbnail.
+func Process(data []byte) (Image, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case TypeJPEG, TypePNG, TypeGIF:
+	default:
+		return Image{}, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("not a valid image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return Image{}, fmt.Errorf("image is too large (%dx%d, at most %d pixels)", config.Width, config.Height, MaxPixels)
+	}
+
+	img := Image{ContentType: contentType}
+	orientation := 1
+	switch contentType {
+	case TypeJPEG:
+		img.Data, orientation, err = stripJPEG(data)
+	case TypePNG:
+		img.Data, err = stripPNG(data)
+	default:
+		// GIFs have nowhere to put EXIF
+		img.Data = data
+	}
+	if err != nil {
+		return Image{}, fmt.Errorf("not a valid image: %w", err)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return Image{}, fmt.Errorf("not a valid image: %w", err)
+	}
+	if orientation != 1 {
+		decoded = orient(decoded, orientation)
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: 90})
+		if err != nil {
+			return Image{}, err
+		}
+		img.Data = buf.Bytes()
+	}
+	img.Width = decoded.Bounds().Dx()
+	img.Height = decoded.Bounds().Dy()
+
+	img.Thumbnail, img.ThumbnailType, err = thumbnail(decoded, contentType)
+	if err != nil {
+		return Image{}, err
+	}
+	return img, nil
+}
@@ -0,0 +1,267 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 200, 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withEXIF puts an APP1 segment right after the JPEG's start of image, with
+// an orientation tag and a camera model so there's something to strip
+func withEXIF(jpg []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(2))
+	// orientation, SHORT, count 1
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	// model, ASCII, count 4, fits in the value field
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0110, 2})
+	binary.Write(&tiff, binary.BigEndian, uint32(4))
+	tiff.WriteString("CAM\x00")
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+// withPNGChunk adds a chunk right after the PNG's IHDR
+func withPNGChunk(p []byte, chunkType string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// signature, then IHDR's 4+4+13+4 bytes
+	ihdrEnd := 8 + 25
+	out := append([]byte{}, p[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, p[ihdrEnd:]...)
+}
+
+func TestProcess(t *testing.T) {
+	var gifBuf bytes.Buffer
+	err := gif.Encode(&gifBuf, testImage(40, 20), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		wantType      string
+		wantW, wantH  int
+		wantThumbType string
+		thumbW        int
+		thumbH        int
+		mustNotHave   string
+	}{
+		{
+			name:          "Small JPEG keeps its size",
+			data:          encodeJPEG(t, testImage(100, 50)),
+			wantType:      TypeJPEG,
+			wantW:         100,
+			wantH:         50,
+			wantThumbType: TypeJPEG,
+			thumbW:        100,
+			thumbH:        50,
+		},
+		{
+			name:          "Wide PNG thumbnail",
+			data:          encodePNG(t, testImage(1000, 500)),
+			wantType:      TypePNG,
+			wantW:         1000,
+			wantH:         500,
+			wantThumbType: TypePNG,
+			thumbW:        ThumbnailSize,
+			thumbH:        ThumbnailSize / 2,
+		},
+		{
+			name:          "Tall JPEG thumbnail",
+			data:          encodeJPEG(t, testImage(200, 800)),
+			wantType:      TypeJPEG,
+			wantW:         200,
+			wantH:         800,
+			wantThumbType: TypeJPEG,
+			thumbW:        ThumbnailSize / 4,
+			thumbH:        ThumbnailSize,
+		},
+		{
+			name:          "EXIF is stripped",
+			data:          withEXIF(encodeJPEG(t, testImage(60, 30)), 1),
+			wantType:      TypeJPEG,
+			wantW:         60,
+			wantH:         30,
+			wantThumbType: TypeJPEG,
+			thumbW:        60,
+			thumbH:        30,
+			mustNotHave:   "Exif",
+		},
+		{
+			name:          "Rotated JPEG is turned upright",
+			data:          withEXIF(encodeJPEG(t, testImage(60, 30)), 6),
+			wantType:      TypeJPEG,
+			wantW:         30,
+			wantH:         60,
+			wantThumbType: TypeJPEG,
+			thumbW:        30,
+			thumbH:        60,
+			mustNotHave:   "Exif",
+		},
+		{
+			name:          "PNG text is stripped",
+			data:          withPNGChunk(encodePNG(t, testImage(10, 10)), "tEXt", []byte("Author\x00someone")),
+			wantType:      TypePNG,
+			wantW:         10,
+			wantH:         10,
+			wantThumbType: TypePNG,
+			thumbW:        10,
+			thumbH:        10,
+			mustNotHave:   "someone",
+		},
+		{
+			name:          "GIF",
+			data:          gifBuf.Bytes(),
+			wantType:      TypeGIF,
+			wantW:         40,
+			wantH:         20,
+			wantThumbType: TypePNG,
+			thumbW:        40,
+			thumbH:        20,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := Process(tc.data)
+			if err != nil {
+				t.Fatalf("Process error: %v", err)
+			}
+			if img.ContentType != tc.wantType || img.Width != tc.wantW || img.Height != tc.wantH {
+				t.Errorf("got %s %dx%d, want %s %dx%d", img.ContentType, img.Width, img.Height, tc.wantType, tc.wantW, tc.wantH)
+			}
+			if tc.mustNotHave != "" && bytes.Contains(img.Data, []byte(tc.mustNotHave)) {
+				t.Errorf("stripped image still contains %q", tc.mustNotHave)
+			}
+			if _, _, err := image.Decode(bytes.NewReader(img.Data)); err != nil {
+				t.Errorf("stripped image doesn't decode: %v", err)
+			}
+
+			if img.ThumbnailType != tc.wantThumbType {
+				t.Errorf("thumbnail type = %s, want %s", img.ThumbnailType, tc.wantThumbType)
+			}
+			thumb, _, err := image.DecodeConfig(bytes.NewReader(img.Thumbnail))
+			if err != nil {
+				t.Fatalf("thumbnail doesn't decode: %v", err)
+			}
+			if thumb.Width != tc.thumbW || thumb.Height != tc.thumbH {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", thumb.Width, thumb.Height, tc.thumbW, tc.thumbH)
+			}
+		})
+	}
+}
+
+func TestProcessRotationMovesPixels(t *testing.T) {
+	// red in the top left corner, which orientation 6 (rotate 90 clockwise)
+	// moves to the top right
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < 16 && y < 16 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	img, err := Process(withEXIF(encodeJPEG(t, src), 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, b, _ := decoded.At(img.Width-4, 4).RGBA()
+	if r < b {
+		t.Errorf("top right corner should be red after rotating, got r=%d b=%d", r>>8, b>>8)
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	// a real PNG header claiming to be 10000x10000
+	huge := encodePNG(t, testImage(1, 1))
+	binary.BigEndian.PutUint32(huge[16:], 10000)
+	binary.BigEndian.PutUint32(huge[20:], 10000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	jpg := encodeJPEG(t, testImage(10, 10))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "Text", data: []byte("just some text"), wantErr: ErrUnsupported},
+		{name: "HTML", data: []byte("<html><script>alert(1)</script></html>"), wantErr: ErrUnsupported},
+		{name: "WebP", data: []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), wantErr: ErrUnsupported},
+		{name: "Empty", data: nil, wantErr: ErrUnsupported},
+		{name: "Too many pixels", data: huge},
+		{name: "Truncated JPEG", data: jpg[:len(jpg)/2]},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Process(tc.data)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
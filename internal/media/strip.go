@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// stripJPEG drops the segments that carry metadata: APP1 (EXIF, XMP), the
+// other application segments but APP0 (JFIF), APP2 (the ICC color profile)
+// and APP14 (Adobe color transform), and comments. It also returns the EXIF
+// orientation, 1 when there's none.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errors.New("missing JPEG start of image")
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	orientation := 1
+
+	i := 2
+	for {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, 0, errors.New("truncated JPEG")
+		}
+		marker := data[i+1]
+		// fill bytes in front of a marker
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		// no length, no payload
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		// the image data runs to the end with no segment lengths to follow,
+		// so the rest is copied as it is
+		if marker == 0xDA || marker == 0xD9 {
+			return append(out, data[i:]...), orientation, nil
+		}
+
+		if i+4 > len(data) {
+			return nil, 0, errors.New("truncated JPEG")
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) || end < i+4 {
+			return nil, 0, errors.New("truncated JPEG")
+		}
+		segment := data[i:end]
+		i = end
+
+		switch {
+		case marker == 0xE1:
+			if o := exifOrientation(segment[4:]); o != 0 {
+				orientation = o
+			}
+		case marker == 0xE0, marker == 0xE2, marker == 0xEE:
+			out = append(out, segment...)
+		case marker >= 0xE3 && marker <= 0xEF, marker == 0xFE:
+		default:
+			out = append(out, segment...)
+		}
+	}
+}
+
+// exifOrientation reads the orientation tag (0x0112) from an APP1 payload,
+// 0 if it isn't EXIF or has no valid orientation
+func exifOrientation(payload []byte) int {
+	tiff, ok := bytes.CutPrefix(payload, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) || ifd < 8 {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// a SHORT, stored left-justified in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are left out of stripped PNGs: EXIF, text (which is where
+// software puts author, comments and XMP) and the last modified time
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG drops the chunks in pngMetadataChunks
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("missing PNG signature")
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	i := len(pngSignature)
+	for i < len(data) {
+		// length, type, data, CRC
+		if i+8 > len(data) {
+			return nil, errors.New("truncated PNG")
+		}
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, errors.New("truncated PNG")
+		}
+		chunkType := string(data[i+4 : i+8])
+		if !pngMetadataChunks[chunkType] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,102 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// ThumbnailSize is the longest side of a thumbnail, in pixels
+const ThumbnailSize = 320
+
+// thumbnail shrinks img to fit in ThumbnailSize, averaging the pixels each
+// thumbnail pixel covers. JPEGs stay JPEGs; PNGs and GIFs become PNGs, they
+// may be transparent.
+func thumbnail(img image.Image, contentType string) ([]byte, string, error) {
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	tw, th := w, h
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			tw, th = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			tw, th = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := range 4 {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			off := dst.PixOffset(x, y)
+			for c := range 4 {
+				dst.Pix[off+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if contentType == TypeJPEG {
+		err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+		return buf.Bytes(), TypeJPEG, err
+	}
+	err := png.Encode(&buf, dst)
+	return buf.Bytes(), TypePNG, err
+}
+
+// toRGBA copies img into an RGBA image with its origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// orient turns img the way EXIF orientation o says it should be displayed
+func orient(img image.Image, o int) image.Image {
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
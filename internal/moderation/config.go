@@ -0,0 +1,114 @@
+package moderation
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the on-disk description of a pipeline, e.g.
+//
+//	{
+//		"censor": "****",
+//		"rules": [
+//			{"name": "profanity", "type": "words", "file": "profanity.txt", "action": "censor"},
+//			{"name": "spam", "type": "regex", "pattern": "(?i)buy\\s+followers", "action": "flag"}
+//		]
+//	}
+//
+// Word list files hold one word per line, blank lines and lines starting with
+// # are skipped. Relative file paths are resolved against the config file.
+type Config struct {
+	Censor string       `json:"censor"`
+	Rules  []RuleConfig `json:"rules"`
+}
+
+type RuleConfig struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Action  string   `json:"action"`
+	File    string   `json:"file,omitempty"`
+	Words   []string `json:"words,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+}
+
+// Load builds a pipeline from the config file at path
+func Load(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read moderation config: %w", err)
+	}
+
+	var cfg Config
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse moderation config: %w", err)
+	}
+
+	baseDir := filepath.Dir(path)
+	rules := make([]Rule, 0, len(cfg.Rules))
+	for _, rc := range cfg.Rules {
+		rule, err := rc.build(baseDir)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return NewPipeline(cfg.Censor, rules...), nil
+}
+
+func (rc RuleConfig) build(baseDir string) (Rule, error) {
+	if rc.Name == "" {
+		return nil, fmt.Errorf("moderation rule is missing a name")
+	}
+	action, err := ParseAction(rc.Action)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", rc.Name, err)
+	}
+
+	switch rc.Type {
+	case "words":
+		list := rc.Words
+		if rc.File != "" {
+			path := rc.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			fromFile, err := readWordList(path)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rc.Name, err)
+			}
+			list = append(list, fromFile...)
+		}
+		return NewWordListRule(rc.Name, action, list), nil
+	case "regex":
+		return NewRegexRule(rc.Name, action, rc.Pattern)
+	}
+	return nil, fmt.Errorf("rule %q: unknown rule type %q", rc.Name, rc.Type)
+}
+
+func readWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open word list: %w", err)
+	}
+	defer f.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read word list: %w", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// leetspeak substitutions undone before matching, so "k3rfuffl3" still hits
+// "kerfuffle"
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'@': 'a',
+	'$': 's',
+}
+
+// Normalize folds a word down to the form word lists are matched against:
+// lowercased, accents stripped and leetspeak undone.
+func Normalize(word string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(word) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if sub, ok := leet[r]; ok {
+			r = sub
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r) {
+		return true
+	}
+	_, ok := leet[r]
+	return ok
+}
+
+// span is a [start, end) byte range in the original text
+type span struct {
+	start, end int
+}
+
+// words splits text on anything that isn't a letter, digit, combining mark or
+// leetspeak symbol, returning the byte range of every word found. Punctuation
+// is never part of a word, so "kerfuffle!" yields "kerfuffle".
+func words(text string) []span {
+	var found []span
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			found = append(found, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		found = append(found, span{start, len(text)})
+	}
+	return found
+}
@@ -0,0 +1,106 @@
+package moderation
+
+import (
+	"sort"
+	"strings"
+)
+
+const DefaultCensor = "****"
+
+// Pipeline runs a chirp body through every rule. It's read-only once built,
+// so reloading rules means building a new Pipeline and swapping it in.
+type Pipeline struct {
+	rules  []Rule
+	censor string
+}
+
+func NewPipeline(censor string, rules ...Rule) *Pipeline {
+	if censor == "" {
+		censor = DefaultCensor
+	}
+	return &Pipeline{rules: rules, censor: censor}
+}
+
+// Rules returns the names of the pipeline's rules, in the order they run
+func (p *Pipeline) Rules() []string {
+	names := make([]string, 0, len(p.rules))
+	for _, rule := range p.rules {
+		names = append(names, rule.Name())
+	}
+	return names
+}
+
+// Match records a rule that objected to a chirp
+type Match struct {
+	Rule   string
+	Action Action
+}
+
+// Verdict is the outcome of a Check
+type Verdict struct {
+	// Body is the chirp with every censored match replaced, the rest of the
+	// text (spacing, punctuation) is left exactly as it was
+	Body     string
+	Rejected bool
+	Flagged  bool
+	// Matches lists every rule that matched, in pipeline order
+	Matches []Match
+}
+
+// RulesFor returns the names of the matched rules with the given action
+func (v Verdict) RulesFor(action Action) []string {
+	var names []string
+	for _, m := range v.Matches {
+		if m.Action == action {
+			names = append(names, m.Rule)
+		}
+	}
+	return names
+}
+
+func (p *Pipeline) Check(body string) Verdict {
+	verdict := Verdict{Body: body}
+	var censored []span
+
+	for _, rule := range p.rules {
+		hits := rule.Match(body)
+		if len(hits) == 0 {
+			continue
+		}
+		verdict.Matches = append(verdict.Matches, Match{Rule: rule.Name(), Action: rule.Action()})
+		switch rule.Action() {
+		case ActionCensor:
+			censored = append(censored, hits...)
+		case ActionReject:
+			verdict.Rejected = true
+		case ActionFlag:
+			verdict.Flagged = true
+		}
+	}
+
+	if len(censored) > 0 {
+		verdict.Body = p.censorSpans(body, censored)
+	}
+	return verdict
+}
+
+// censorSpans replaces each span with the censor string, merging any that
+// overlap so two rules hitting the same word only censor it once
+func (p *Pipeline) censorSpans(body string, spans []span) string {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(spans); i++ {
+		current := spans[i]
+		for i+1 < len(spans) && spans[i+1].start < current.end {
+			current.end = max(current.end, spans[i+1].end)
+			i++
+		}
+		b.WriteString(body[last:current.start])
+		b.WriteString(p.censor)
+		last = current.end
+	}
+	b.WriteString(body[last:])
+	return b.String()
+}
@@ -0,0 +1,131 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPipelineCheck(t *testing.T) {
+	spam, err := NewRegexRule("spam", ActionFlag, `(?i)buy\s+followers`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := NewPipeline("****",
+		NewWordListRule("profanity", ActionCensor, []string{"kerfuffle", "sharbert", "fornax"}),
+		NewWordListRule("banned", ActionReject, []string{"zorblax"}),
+		spam,
+	)
+
+	tests := []struct {
+		name         string
+		body         string
+		wantBody     string
+		wantRejected bool
+		wantFlagged  bool
+	}{
+		{
+			name:     "Clean chirp",
+			body:     "I had something interesting for breakfast",
+			wantBody: "I had something interesting for breakfast",
+		},
+		{
+			name:     "Trailing punctuation",
+			body:     "what a kerfuffle!",
+			wantBody: "what a ****!",
+		},
+		{
+			name:     "Spacing is preserved",
+			body:     "so  much   Sharbert",
+			wantBody: "so  much   ****",
+		},
+		{
+			name:     "Leetspeak",
+			body:     "f0rn4x and k3rfuffl3",
+			wantBody: "**** and ****",
+		},
+		{
+			name:     "Accents",
+			body:     "fórnax",
+			wantBody: "****",
+		},
+		{
+			name:     "Leading symbol",
+			body:     "hey @fornax",
+			wantBody: "hey ****",
+		},
+		{
+			name:     "Substring is not a match",
+			body:     "kerfuffles",
+			wantBody: "kerfuffles",
+		},
+		{
+			name:         "Rejected",
+			body:         "zorblax",
+			wantBody:     "zorblax",
+			wantRejected: true,
+		},
+		{
+			name:        "Flagged",
+			body:        "Buy  followers now",
+			wantBody:    "Buy  followers now",
+			wantFlagged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := pipeline.Check(tt.body)
+			if verdict.Body != tt.wantBody {
+				t.Errorf("Check() body = %q, want %q", verdict.Body, tt.wantBody)
+			}
+			if verdict.Rejected != tt.wantRejected {
+				t.Errorf("Check() rejected = %v, want %v", verdict.Rejected, tt.wantRejected)
+			}
+			if verdict.Flagged != tt.wantFlagged {
+				t.Errorf("Check() flagged = %v, want %v", verdict.Flagged, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "words.txt"), []byte("# comment\nkerfuffle\n\nfornax\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := `{
+		"censor": "###",
+		"rules": [
+			{"name": "profanity", "type": "words", "file": "words.txt", "action": "censor"},
+			{"name": "spam", "type": "regex", "pattern": "(?i)free money", "action": "reject"}
+		]
+	}`
+	path := filepath.Join(dir, "rules.json")
+	err = os.WriteFile(path, []byte(config), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	verdict := pipeline.Check("Fornax, FREE MONEY")
+	if verdict.Body != "###, FREE MONEY" {
+		t.Errorf("Check() body = %q", verdict.Body)
+	}
+	if !verdict.Rejected {
+		t.Errorf("Check() should have rejected")
+	}
+	if got := verdict.RulesFor(ActionReject); len(got) != 1 || got[0] != "spam" {
+		t.Errorf("RulesFor(ActionReject) = %v", got)
+	}
+
+	badConfig := filepath.Join(dir, "bad.json")
+	os.WriteFile(badConfig, []byte(`{"rules": [{"name": "x", "type": "regex", "pattern": "(", "action": "flag"}]}`), 0o644)
+	if _, err := Load(badConfig); err == nil {
+		t.Errorf("Load() with a bad pattern should fail")
+	}
+}
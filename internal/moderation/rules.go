@@ -0,0 +1,133 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Action is what the pipeline does with a chirp when a rule matches it
+type Action int
+
+const (
+	// ActionCensor replaces the matched text with the censor string
+	ActionCensor Action = iota
+	// ActionReject refuses the chirp outright
+	ActionReject
+	// ActionFlag lets the chirp through but marks it for a moderator to review
+	ActionFlag
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionCensor:
+		return "censor"
+	case ActionReject:
+		return "reject"
+	case ActionFlag:
+		return "flag"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction is the inverse of Action.String
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "censor":
+		return ActionCensor, nil
+	case "reject":
+		return ActionReject, nil
+	case "flag":
+		return ActionFlag, nil
+	}
+	return 0, fmt.Errorf("unknown moderation action %q", s)
+}
+
+// Rule finds offending text in a chirp. Match returns the byte ranges it
+// objects to, nil if the text is fine.
+type Rule interface {
+	Name() string
+	Action() Action
+	Match(text string) []span
+}
+
+// WordListRule matches whole words against a list, after normalizing both
+// sides (see Normalize)
+type WordListRule struct {
+	name   string
+	action Action
+	words  map[string]struct{}
+}
+
+func NewWordListRule(name string, action Action, list []string) *WordListRule {
+	rule := &WordListRule{
+		name:   name,
+		action: action,
+		words:  make(map[string]struct{}, len(list)),
+	}
+	for _, w := range list {
+		w = Normalize(strings.TrimSpace(w))
+		if w == "" {
+			continue
+		}
+		rule.words[w] = struct{}{}
+	}
+	return rule
+}
+
+func (r *WordListRule) Name() string   { return r.name }
+func (r *WordListRule) Action() Action { return r.action }
+
+func (r *WordListRule) Match(text string) []span {
+	var hits []span
+	for _, w := range words(text) {
+		if r.matchWord(text[w.start:w.end]) {
+			hits = append(hits, w)
+		}
+	}
+	return hits
+}
+
+func (r *WordListRule) matchWord(word string) bool {
+	if _, ok := r.words[Normalize(word)]; ok {
+		return true
+	}
+	// "@" and "$" are only leetspeak in the middle of a word, "$kerfuffle" or
+	// "@fornax" should match on what's left after dropping them
+	trimmed := strings.Trim(word, "@$")
+	if trimmed == "" || trimmed == word {
+		return false
+	}
+	_, ok := r.words[Normalize(trimmed)]
+	return ok
+}
+
+// RegexRule matches a regular expression against the raw chirp body. Use
+// (?i) in the pattern for case-insensitive matching.
+type RegexRule struct {
+	name    string
+	action  Action
+	pattern *regexp.Regexp
+}
+
+func NewRegexRule(name string, action Action, pattern string) (*RegexRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: invalid pattern: %w", name, err)
+	}
+	return &RegexRule{name: name, action: action, pattern: re}, nil
+}
+
+func (r *RegexRule) Name() string   { return r.name }
+func (r *RegexRule) Action() Action { return r.action }
+
+func (r *RegexRule) Match(text string) []span {
+	var hits []span
+	for _, loc := range r.pattern.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		hits = append(hits, span{loc[0], loc[1]})
+	}
+	return hits
+}
@@ -0,0 +1,161 @@
+// Package realtime fans events out to live connections (SSE streams,
+// websockets) and keeps the last few around so a client that reconnects can
+// pick up where it left off.
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// SubscriberBuffer is how many events a subscriber can fall behind before
+// it's dropped. A dropped client reconnects and resumes from the hub's buffer
+// instead of holding everyone else up.
+const SubscriberBuffer = 64
+
+// Event is one thing that happened. Data is what's sent to clients, the
+// rest is for deciding which clients it's sent to.
+type Event struct {
+	ID   int64
+	Type string
+	Data json.RawMessage
+
+	// when set, the event is private to these users (notifications, direct
+	// messages)
+	Recipients []uuid.UUID
+	// the user whose action it is, e.g. the author of a chirp
+	Actor uuid.UUID
+	// other users the event shows, e.g. the author of a quoted chirp
+	Involved []uuid.UUID
+	Tags     []string
+	// who may see a chirp event on top of the public: "followers" of the
+	// actor and the Mentioned users, or only the Mentioned. Empty and
+	// "public" mean anyone.
+	Visibility string
+	Mentioned  []uuid.UUID
+	// the actor's account is protected, so whatever the visibility only
+	// their followers see their chirps
+	Protected bool
+	// the conversation a chirp event belongs to, the ID of its first chirp
+	Thread uuid.UUID
+}
+
+// Hub keeps the last bufferSize events in the order they were published and
+// hands new ones to every subscriber.
+//
+// Resuming goes by position, not by comparing IDs: events come from a
+// Postgres sequence but arrive in commit order, which every instance sees
+// the same way, so "everything after event N" is the same list everywhere
+// even though the IDs in it aren't sorted.
+type Hub struct {
+	mu     sync.Mutex
+	buffer []Event
+	size   int
+	subs   map[*Subscription]struct{}
+}
+
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		size: bufferSize,
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+	// set when the hub dropped the subscription for falling behind
+	lagged bool
+	closed bool
+}
+
+// Events is closed when the subscription ends, either by Close or because
+// the subscriber fell behind (see Lagged).
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged reports whether the hub dropped the subscription because it wasn't
+// keeping up. Only meaningful once Events is closed.
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Publish records an event and passes it to every subscriber
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.buffer) == h.size {
+		copy(h.buffer, h.buffer[1:])
+		h.buffer = h.buffer[:h.size-1]
+	}
+	h.buffer = append(h.buffer, e)
+
+	for sub := range h.subs {
+		select {
+		case sub.events <- e:
+		default:
+			sub.lagged = true
+			h.remove(sub)
+		}
+	}
+}
+
+// Subscribe starts a subscription. With resume set, replay is every buffered
+// event after the one with ID lastID, and found is false when that event
+// isn't in the buffer anymore (or never was), in which case the client has
+// missed events and should reload instead.
+func (h *Hub) Subscribe(resume bool, lastID int64) (sub *Subscription, replay []Event, found bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	found = !resume
+	if resume {
+		for i := len(h.buffer) - 1; i >= 0; i-- {
+			if h.buffer[i].ID == lastID {
+				replay = append(replay, h.buffer[i+1:]...)
+				found = true
+				break
+			}
+		}
+	}
+
+	sub = &Subscription{hub: h, events: make(chan Event, SubscriberBuffer)}
+	h.subs[sub] = struct{}{}
+	return sub, replay, found
+}
+
+// Reset forgets the buffer, for when events may have been missed (the
+// connection carrying them dropped). Subscribers are ended as if they lagged
+// so they reconnect, and with nothing to resume from they'll reload.
+func (h *Hub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buffer = nil
+	for sub := range h.subs {
+		sub.lagged = true
+		h.remove(sub)
+	}
+}
+
+// remove must be called with h.mu held
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(h.subs, sub)
+	close(sub.events)
+}
@@ -0,0 +1,141 @@
+package realtime
+
+import (
+	"testing"
+)
+
+func publishIDs(h *Hub, ids ...int64) {
+	for _, id := range ids {
+		h.Publish(Event{ID: id, Type: "test"})
+	}
+}
+
+func eventIDs(events []Event) []int64 {
+	ids := []int64{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSubscribeReceivesEvents(t *testing.T) {
+	h := NewHub(10)
+	sub, _, found := h.Subscribe(false, 0)
+	defer sub.Close()
+	if !found {
+		t.Fatalf("a fresh subscription should never need a reload")
+	}
+
+	publishIDs(h, 1, 2)
+	for _, want := range []int64{1, 2} {
+		got := <-sub.Events()
+		if got.ID != want {
+			t.Errorf("got event %d, want %d", got.ID, want)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name       string
+		published  []int64
+		lastID     int64
+		wantReplay []int64
+		wantFound  bool
+	}{
+		{
+			name:       "Resume from the middle",
+			published:  []int64{1, 2, 3, 4},
+			lastID:     2,
+			wantReplay: []int64{3, 4},
+			wantFound:  true,
+		},
+		{
+			name:       "Resume by position when IDs arrive out of order",
+			published:  []int64{5, 3, 4, 7, 6},
+			lastID:     4,
+			wantReplay: []int64{7, 6},
+			wantFound:  true,
+		},
+		{
+			name:       "Up to date",
+			published:  []int64{1, 2},
+			lastID:     2,
+			wantReplay: []int64{},
+			wantFound:  true,
+		},
+		{
+			name:       "Fell out of the buffer",
+			published:  []int64{1, 2, 3, 4, 5},
+			lastID:     1,
+			wantReplay: []int64{},
+			wantFound:  false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHub(4)
+			publishIDs(h, tc.published...)
+			sub, replay, found := h.Subscribe(true, tc.lastID)
+			defer sub.Close()
+			if found != tc.wantFound {
+				t.Errorf("found = %v, want %v", found, tc.wantFound)
+			}
+			if got := eventIDs(replay); !equalIDs(got, tc.wantReplay) {
+				t.Errorf("replay = %v, want %v", got, tc.wantReplay)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := NewHub(10)
+	slow, _, _ := h.Subscribe(false, 0)
+
+	for i := 0; i <= SubscriberBuffer; i++ {
+		h.Publish(Event{ID: int64(i)})
+	}
+
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received != SubscriberBuffer {
+		t.Errorf("received %d events before being dropped, want %d", received, SubscriberBuffer)
+	}
+	if !slow.Lagged() {
+		t.Errorf("a dropped subscription should report it lagged")
+	}
+	// closing again after being dropped is fine
+	slow.Close()
+}
+
+func TestReset(t *testing.T) {
+	h := NewHub(10)
+	publishIDs(h, 1, 2)
+	sub, _, _ := h.Subscribe(false, 0)
+
+	h.Reset()
+	if _, open := <-sub.Events(); open {
+		t.Errorf("subscriptions should end on reset")
+	}
+
+	resumed, _, found := h.Subscribe(true, 1)
+	defer resumed.Close()
+	if found {
+		t.Errorf("nothing should be resumable after a reset")
+	}
+}
@@ -0,0 +1,114 @@
+// Package search parses what users type into the search box.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+)
+
+// DateLayout is the format since: and until: take
+const DateLayout = "2006-01-02"
+
+// Query is a parsed search. Text is what's left once the operators are taken
+// out, in the syntax Postgres' websearch_to_tsquery reads: "quoted phrases",
+// -excluded words and or.
+type Query struct {
+	Text string
+	// a handle, without the @
+	From string
+	// Since is the start of its day and Until the start of the day after the
+	// last one included, both UTC. Zero when not given.
+	Since time.Time
+	Until time.Time
+}
+
+// Parse splits a search into its free text and the from:, since: and until:
+// operators. Operators inside quotes are just text. until: is inclusive,
+// "until:2024-05-01" still finds chirps from that day.
+func Parse(raw string) (Query, error) {
+	var q Query
+	var text []string
+	for _, token := range tokenize(raw) {
+		name, value, isOperator := operator(token)
+		if !isOperator {
+			text = append(text, token)
+			continue
+		}
+		if value == "" {
+			return Query{}, fmt.Errorf("%s: needs a value", name)
+		}
+		switch name {
+		case "from":
+			if q.From != "" {
+				return Query{}, errors.New("only one from: is allowed")
+			}
+			handle := strings.TrimPrefix(value, "@")
+			if err := chirptext.ValidateHandle(handle); err != nil {
+				return Query{}, fmt.Errorf("from: %w", err)
+			}
+			q.From = handle
+		case "since", "until":
+			day, err := time.Parse(DateLayout, value)
+			if err != nil {
+				return Query{}, fmt.Errorf("%s: takes a date like %s", name, DateLayout)
+			}
+			if name == "since" {
+				q.Since = day
+			} else {
+				q.Until = day.AddDate(0, 0, 1)
+			}
+		}
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return Query{}, errors.New("since: has to be before until:")
+	}
+	q.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+// operator splits "name:value" for the operators Parse knows, names are
+// case insensitive
+func operator(token string) (name, value string, ok bool) {
+	name, value, found := strings.Cut(token, ":")
+	if !found {
+		return "", "", false
+	}
+	name = strings.ToLower(name)
+	switch name {
+	case "from", "since", "until":
+		return name, value, true
+	}
+	return "", "", false
+}
+
+// tokenize splits on whitespace outside of double quotes. Quoted parts keep
+// their quotes so websearch_to_tsquery still sees a phrase, a quote that's
+// never closed runs to the end.
+func tokenize(raw string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse(DateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		want Query
+	}{
+		{
+			name: "Plain words",
+			raw:  "golang generics",
+			want: Query{Text: "golang generics"},
+		},
+		{
+			name: "Extra whitespace collapses",
+			raw:  "  golang \t generics\n",
+			want: Query{Text: "golang generics"},
+		},
+		{
+			name: "Phrase keeps its quotes and spaces",
+			raw:  `"type parameters" go`,
+			want: Query{Text: `"type parameters" go`},
+		},
+		{
+			name: "Excluded words and or pass through",
+			raw:  "go -java or rust",
+			want: Query{Text: "go -java or rust"},
+		},
+		{
+			name: "From with and without the at",
+			raw:  "from:@Alice_1 hello",
+			want: Query{Text: "hello", From: "Alice_1"},
+		},
+		{
+			name: "Operator names are case insensitive",
+			raw:  "FROM:bob",
+			want: Query{From: "bob"},
+		},
+		{
+			name: "Since and until",
+			raw:  "since:2024-05-01 until:2024-05-03 release",
+			want: Query{Text: "release", Since: day("2024-05-01"), Until: day("2024-05-04")},
+		},
+		{
+			name: "Same day on both ends",
+			raw:  "since:2024-05-01 until:2024-05-01",
+			want: Query{Since: day("2024-05-01"), Until: day("2024-05-02")},
+		},
+		{
+			name: "Operators inside quotes are text",
+			raw:  `"from:alice says"`,
+			want: Query{Text: `"from:alice says"`},
+		},
+		{
+			name: "Unknown operators are text",
+			raw:  "lang:go https://go.dev",
+			want: Query{Text: "lang:go https://go.dev"},
+		},
+		{
+			name: "Unclosed quote runs to the end",
+			raw:  `"open ended phrase`,
+			want: Query{Text: `"open ended phrase`},
+		},
+		{
+			name: "Empty",
+			raw:  "",
+			want: Query{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.raw)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tc.raw, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tc.raw, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "Empty from", raw: "from: hello"},
+		{name: "Invalid handle", raw: "from:no-dashes"},
+		{name: "Two froms", raw: "from:alice from:bob"},
+		{name: "Bad date", raw: "since:yesterday"},
+		{name: "Date with time", raw: "until:2024-05-01T10:00:00Z"},
+		{name: "Since after until", raw: "since:2024-05-03 until:2024-05-01"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(tc.raw); err == nil {
+				t.Errorf("Parse(%q) expected an error", tc.raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// Package storage keeps blobs (uploaded media) somewhere other than the
+// database: on local disk, or in an S3 compatible bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key nothing was stored under
+var ErrNotFound = errors.New("blob not found")
+
+// Storage is where blobs live. Keys are slash separated paths like
+// "media/<id>", made up by the caller. Putting to a key that's taken
+// replaces what's there, deleting a key that isn't is not an error.
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// the caller closes the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey rejects keys that could climb out of wherever the backend keeps
+// its blobs, or that don't map to a path the same way everywhere
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+// Package websocket is the server side of the WebSocket protocol (RFC 6455),
+// as much of it as the realtime API needs: the opening handshake, text and
+// binary messages (fragmented or not), ping/pong and the closing handshake.
+// Extensions and subprotocols aren't supported, a client asking for them
+// just doesn't get them.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// appended to the client's key to make the accept header, from the RFC
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+type MessageType int
+
+const (
+	continuationFrame MessageType = 0
+	TextMessage       MessageType = 1
+	BinaryMessage     MessageType = 2
+	closeFrame        MessageType = 8
+	pingFrame         MessageType = 9
+	pongFrame         MessageType = 10
+)
+
+// close codes, section 7.4.1
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	// sent as "no status" when a close frame has no code, never on the wire
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	CloseTryAgainLater   = 1013
+)
+
+// control frames can't be fragmented or carry more than this
+const maxControlPayload = 125
+
+// DefaultMaxMessageSize is the largest message ReadMessage accepts unless
+// SetMaxMessageSize says otherwise
+const DefaultMaxMessageSize = 64 * 1024
+
+var (
+	ErrMessageTooBig = errors.New("websocket: message too big")
+	errProtocol      = errors.New("websocket: protocol error")
+)
+
+// CloseError is returned by ReadMessage once the other side has closed the
+// connection
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with %d %s", e.Code, e.Reason)
+}
+
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// one frame at a time, the reader answers pings while someone else may
+	// be sending
+	writeMu   sync.Mutex
+	closeSent bool
+
+	maxMessageSize int64
+	pongHandler    func(payload []byte)
+}
+
+// acceptKey is the Sec-WebSocket-Accept value for a Sec-WebSocket-Key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma separated header contains token,
+// ignoring case ("Connection: keep-alive, Upgrade")
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade does the opening handshake and takes over the connection. When the
+// request isn't a valid WebSocket handshake it answers with an HTTP error
+// itself and returns an error.
+//
+// Origin isn't checked: the API authenticates with bearer tokens, never
+// cookies, so another site can't ride on a user's session.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	fail := func(code int, msg string) (*Conn, error) {
+		http.Error(w, msg, code)
+		return nil, errors.New("websocket: " + msg)
+	}
+
+	if r.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "handshake must be a GET")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, "connection can't be upgraded")
+	}
+	// the handshake is done once the response is out, whatever the client
+	// sent after it is already waiting in brw.Reader
+	netConn.SetDeadline(time.Time{})
+	_, err = io.WriteString(netConn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+acceptKey(key)+"\r\n\r\n")
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return newConn(netConn, brw.Reader), nil
+}
+
+func newConn(netConn net.Conn, br *bufio.Reader) *Conn {
+	return &Conn{
+		conn:           netConn,
+		br:             br,
+		maxMessageSize: DefaultMaxMessageSize,
+	}
+}
+
+func (c *Conn) SetMaxMessageSize(size int64) {
+	c.maxMessageSize = size
+}
+
+// SetPongHandler sets what runs when a pong arrives. It's called from
+// ReadMessage, so only while someone is reading.
+func (c *Conn) SetPongHandler(h func(payload []byte)) {
+	c.pongHandler = h
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Close drops the connection without a closing handshake, use WriteClose
+// first for a clean one
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+type frame struct {
+	fin     bool
+	opcode  MessageType
+	payload []byte
+}
+
+// readFrame reads one client frame, unmasking it. remaining is how much
+// more the message being read may grow.
+func (c *Conn) readFrame(remaining int64) (frame, error) {
+	var header [2]byte
+	_, err := io.ReadFull(c.br, header[:])
+	if err != nil {
+		return frame{}, err
+	}
+
+	f := frame{
+		fin:    header[0]&0x80 != 0,
+		opcode: MessageType(header[0] & 0x0f),
+	}
+	// no extensions were agreed, so the reserved bits must be clear
+	if header[0]&0x70 != 0 {
+		return f, errProtocol
+	}
+	// clients must mask everything they send
+	if header[1]&0x80 == 0 {
+		return f, errProtocol
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return f, errProtocol
+		}
+	}
+	if err != nil {
+		return f, err
+	}
+
+	isControl := f.opcode >= closeFrame
+	if isControl && (!f.fin || length > maxControlPayload) {
+		return f, errProtocol
+	}
+	if !isControl && length > remaining {
+		return f, ErrMessageTooBig
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(c.br, mask[:])
+	if err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	_, err = io.ReadFull(c.br, f.payload)
+	if err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// ReadMessage returns the next text or binary message, putting fragmented
+// ones back together. Pings are answered and pongs passed to the pong
+// handler on the way. Protocol violations close the connection with the
+// matching code. Once the client closes, the close is acknowledged and a
+// *CloseError returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		messageType MessageType
+		message     []byte
+	)
+	for {
+		f, err := c.readFrame(c.maxMessageSize - int64(len(message)))
+		if err != nil {
+			switch {
+			case errors.Is(err, errProtocol):
+				c.WriteClose(CloseProtocolError, "")
+			case errors.Is(err, ErrMessageTooBig):
+				c.WriteClose(CloseMessageTooBig, "")
+			}
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case pingFrame:
+			err = c.writeFrame(pongFrame, f.payload)
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongFrame:
+			if c.pongHandler != nil {
+				c.pongHandler(f.payload)
+			}
+			continue
+		case closeFrame:
+			return 0, nil, c.handleClose(f.payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				c.WriteClose(CloseProtocolError, "")
+				return 0, nil, errProtocol
+			}
+			messageType = f.opcode
+		case continuationFrame:
+			if messageType == 0 {
+				c.WriteClose(CloseProtocolError, "")
+				return 0, nil, errProtocol
+			}
+		default:
+			c.WriteClose(CloseProtocolError, "")
+			return 0, nil, errProtocol
+		}
+
+		message = append(message, f.payload...)
+		if !f.fin {
+			continue
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			c.WriteClose(CloseInvalidPayload, "")
+			return 0, nil, errors.New("websocket: invalid UTF-8 in text message")
+		}
+		if message == nil {
+			message = []byte{}
+		}
+		return messageType, message, nil
+	}
+}
+
+// handleClose answers a close frame with one carrying the same code, which
+// finishes the closing handshake
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		c.WriteClose(CloseProtocolError, "")
+		return errProtocol
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) || !utf8.ValidString(closeErr.Reason) {
+			c.WriteClose(CloseProtocolError, "")
+			return errProtocol
+		}
+	}
+
+	code := closeErr.Code
+	if code == CloseNoStatus {
+		code = CloseNormal
+	}
+	c.WriteClose(code, "")
+	return closeErr
+}
+
+// validCloseCode is whether a code may be sent in a close frame: the ones the
+// RFC defines for that, and the ranges for libraries (3000-3999) and
+// applications (4000-4999)
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// WriteMessage sends a text or binary message as a single frame
+func (c *Conn) WriteMessage(messageType MessageType, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: can't send message type %d", messageType)
+	}
+	return c.writeFrame(messageType, data)
+}
+
+func (c *Conn) WritePing(payload []byte) error {
+	return c.writeFrame(pingFrame, payload)
+}
+
+// WriteClose starts (or answers) the closing handshake. Only the first call
+// sends anything, nothing else can be sent after it.
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	return c.writeFrame(closeFrame, payload)
+}
+
+// writeFrame sends one unmasked frame with FIN set, servers never fragment
+func (c *Conn) writeFrame(opcode MessageType, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == closeFrame {
+		c.closeSent = true
+	}
+
+	header := make([]byte, 0, 10+len(payload))
+	header = append(header, 0x80|byte(opcode))
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
@@ -0,0 +1,380 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// clientFrame builds a masked frame the way a client sends it
+func clientFrame(fin bool, opcode MessageType, payload []byte) []byte {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	out := []byte{b0}
+	switch length := len(payload); {
+	case length <= 125:
+		out = append(out, 0x80|byte(length))
+	case length <= 0xffff:
+		out = append(out, 0x80|126)
+		out = binary.BigEndian.AppendUint16(out, uint16(length))
+	default:
+		out = append(out, 0x80|127)
+		out = binary.BigEndian.AppendUint64(out, uint64(length))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	out = append(out, mask[:]...)
+	for i, b := range payload {
+		out = append(out, b^mask[i%4])
+	}
+	return out
+}
+
+// readServerFrame reads one unmasked frame written by the server
+func readServerFrame(t *testing.T, r io.Reader) (MessageType, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatalf("reading frame header: %v", err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatalf("server frames must not be masked")
+	}
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("reading frame payload: %v", err)
+	}
+	return MessageType(header[0] & 0x0f), payload
+}
+
+// pipe returns a server Conn and the client end of the connection
+func pipe(t *testing.T) (*Conn, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return newConn(server, bufio.NewReader(server)), client
+}
+
+// send writes frames from the client without waiting for the server to read
+// them, net.Pipe has no buffer
+func send(client net.Conn, frames ...[]byte) {
+	go func() {
+		for _, f := range frames {
+			if _, err := client.Write(f); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestAcceptKey(t *testing.T) {
+	// the example from section 1.3 of the RFC
+	got := acceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	if got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey = %q", got)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, msg, err := conn.ReadMessage()
+		if err == nil {
+			conn.WriteMessage(TextMessage, msg)
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("Not a handshake", func(t *testing.T) {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", resp.StatusCode)
+		}
+	})
+
+	t.Run("Wrong version", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "8")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("status = %d, version = %q", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Version"))
+		}
+	})
+
+	t.Run("Echo", func(t *testing.T) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n"+
+			"Connection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n"+
+			"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+		conn.Write(clientFrame(true, TextMessage, []byte("hello")))
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("status = %d, want 101", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("Sec-WebSocket-Accept = %q", got)
+		}
+		opcode, payload := readServerFrame(t, br)
+		if opcode != TextMessage || string(payload) != "hello" {
+			t.Errorf("got %d %q, want the message echoed", opcode, payload)
+		}
+	})
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   string
+	}{
+		{
+			name:   "Single frame",
+			frames: [][]byte{clientFrame(true, TextMessage, []byte("hi"))},
+			want:   "hi",
+		},
+		{
+			name: "Fragmented",
+			frames: [][]byte{
+				clientFrame(false, TextMessage, []byte("hel")),
+				clientFrame(false, continuationFrame, []byte("lo ")),
+				clientFrame(true, continuationFrame, []byte("there")),
+			},
+			want: "hello there",
+		},
+		{
+			name: "Ping between fragments",
+			frames: [][]byte{
+				clientFrame(false, TextMessage, []byte("a")),
+				clientFrame(true, pingFrame, []byte("p")),
+				clientFrame(true, continuationFrame, []byte("b")),
+			},
+			want: "ab",
+		},
+		{
+			name:   "16 bit length",
+			frames: [][]byte{clientFrame(true, BinaryMessage, []byte(strings.Repeat("x", 300)))},
+			want:   strings.Repeat("x", 300),
+		},
+		{
+			name:   "Empty",
+			frames: [][]byte{clientFrame(true, TextMessage, nil)},
+			want:   "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, client := pipe(t)
+			send(client, tc.frames...)
+			// answer to the ping, if there is one
+			go io.Copy(io.Discard, client)
+
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(msg) != tc.want {
+				t.Errorf("got %q, want %q", msg, tc.want)
+			}
+		})
+	}
+}
+
+func TestPingIsAnswered(t *testing.T) {
+	conn, client := pipe(t)
+	send(client,
+		clientFrame(true, pingFrame, []byte("are you there")),
+		clientFrame(true, TextMessage, []byte("done")),
+	)
+	go conn.ReadMessage()
+
+	opcode, payload := readServerFrame(t, client)
+	if opcode != pongFrame || string(payload) != "are you there" {
+		t.Errorf("got %d %q, want a pong with the ping's payload", opcode, payload)
+	}
+}
+
+func TestPongHandler(t *testing.T) {
+	conn, client := pipe(t)
+	var got string
+	conn.SetPongHandler(func(payload []byte) { got = string(payload) })
+	send(client,
+		clientFrame(true, pongFrame, []byte("beat")),
+		clientFrame(true, TextMessage, []byte("done")),
+	)
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if got != "beat" {
+		t.Errorf("pong handler got %q", got)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	unmasked := clientFrame(true, TextMessage, []byte("hi"))
+	unmasked[1] &^= 0x80
+	unmasked = append(unmasked[:2], []byte("hi")...)
+
+	tests := []struct {
+		name      string
+		frames    [][]byte
+		wantClose int
+	}{
+		{
+			name:      "Unmasked frame",
+			frames:    [][]byte{unmasked},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "Reserved bit set",
+			frames:    [][]byte{append([]byte{0x80 | 0x40 | 0x1}, clientFrame(true, TextMessage, nil)[1:]...)},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "Continuation without a start",
+			frames:    [][]byte{clientFrame(true, continuationFrame, []byte("x"))},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name: "New message inside a fragmented one",
+			frames: [][]byte{
+				clientFrame(false, TextMessage, []byte("x")),
+				clientFrame(true, TextMessage, []byte("y")),
+			},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "Fragmented control frame",
+			frames:    [][]byte{clientFrame(false, pingFrame, nil)},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "Invalid UTF-8",
+			frames:    [][]byte{clientFrame(true, TextMessage, []byte{0xff, 0xfe})},
+			wantClose: CloseInvalidPayload,
+		},
+		{
+			name:      "Too big",
+			frames:    [][]byte{clientFrame(true, BinaryMessage, make([]byte, 2000))},
+			wantClose: CloseMessageTooBig,
+		},
+		{
+			name: "Too big across fragments",
+			frames: [][]byte{
+				clientFrame(false, BinaryMessage, make([]byte, 600)),
+				clientFrame(true, continuationFrame, make([]byte, 600)),
+			},
+			wantClose: CloseMessageTooBig,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, client := pipe(t)
+			conn.SetMaxMessageSize(1000)
+			send(client, tc.frames...)
+
+			done := make(chan error, 1)
+			go func() {
+				_, _, err := conn.ReadMessage()
+				done <- err
+			}()
+
+			opcode, payload := readServerFrame(t, client)
+			if opcode != closeFrame || len(payload) < 2 {
+				t.Fatalf("got frame %d %q, want a close", opcode, payload)
+			}
+			if code := int(binary.BigEndian.Uint16(payload)); code != tc.wantClose {
+				t.Errorf("close code = %d, want %d", code, tc.wantClose)
+			}
+			if err := <-done; err == nil {
+				t.Errorf("ReadMessage should fail")
+			}
+		})
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	conn, client := pipe(t)
+	payload := binary.BigEndian.AppendUint16(nil, CloseGoingAway)
+	payload = append(payload, "bye"...)
+	send(client, clientFrame(true, closeFrame, payload))
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadMessage()
+		done <- err
+	}()
+
+	opcode, echoed := readServerFrame(t, client)
+	if opcode != closeFrame || binary.BigEndian.Uint16(echoed) != CloseGoingAway {
+		t.Errorf("got %d %v, want the close code echoed", opcode, echoed)
+	}
+
+	var closeErr *CloseError
+	if err := <-done; !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway || closeErr.Reason != "bye" {
+		t.Errorf("got %v, want a CloseError with the client's code and reason", err)
+	}
+
+	// nothing more goes out once a close was sent
+	if err := conn.WriteMessage(TextMessage, []byte("late")); err == nil {
+		t.Errorf("writing after the close should fail")
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	for _, size := range []int{5, 200, 70000} {
+		conn, client := pipe(t)
+		msg := strings.Repeat("m", size)
+		go conn.WriteMessage(TextMessage, []byte(msg))
+
+		opcode, payload := readServerFrame(t, client)
+		if opcode != TextMessage || string(payload) != msg {
+			t.Errorf("size %d: got opcode %d and %d bytes", size, opcode, len(payload))
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/auth"
+
+	"github.com/google/uuid"
+)
+
+// token introspection as described in RFC 7662, for trusted clients (e.g. the
+// gateway) that need to know if a chirpy token is still good without parsing
+// the JWT themselves
+
+// introspectionResponse only carries "active" for inactive tokens, the spec
+// says nothing else should be disclosed about them
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// parseIntrospectionClients reads "id:secret" pairs separated by commas, as
+// found in the INTROSPECTION_CLIENTS env var
+func parseIntrospectionClients(raw string) map[string]string {
+	clients := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		id, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found || id == "" || secret == "" {
+			continue
+		}
+		clients[id] = secret
+	}
+	return clients
+}
+
+func (cfg *apiConfig) introspectionClientAllowed(r *http.Request) bool {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	expected, found := cfg.introspectionClients[id]
+	if !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+}
+
+func (cfg *apiConfig) introspectToken(w http.ResponseWriter, r *http.Request) {
+	if !cfg.introspectionClientAllowed(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		respondWithError(w, http.StatusUnauthorized, "invalid client credentials")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondWithError(w, 400, "missing token")
+		return
+	}
+
+	var resp introspectionResponse
+	// refresh tokens are opaque, so anything that isn't JWT-shaped is looked
+	// up in the refresh_tokens table instead
+	if r.PostForm.Get("token_type_hint") == "refresh_token" || strings.Count(token, ".") != 2 {
+		resp = cfg.introspectRefreshToken(r, token)
+	} else {
+		resp = cfg.introspectAccessToken(r, token)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = respondWithJSON(w, 200, resp)
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
+
+func (cfg *apiConfig) introspectAccessToken(r *http.Request, token string) introspectionResponse {
+	claims, err := auth.ParseJWT(token, cfg.secret)
+	if err != nil {
+		return introspectionResponse{}
+	}
+
+	userUUID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return introspectionResponse{}
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userUUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Println("error fetching user for introspection: ", err)
+		}
+		return introspectionResponse{}
+	}
+	if user.SuspendedAt.Valid {
+		return introspectionResponse{}
+	}
+
+	resp := introspectionResponse{
+		Active:    true,
+		TokenType: "access_token",
+		Subject:   user.ID.String(),
+		Username:  user.Email,
+		Issuer:    claims.Issuer,
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	return resp
+}
+
+func (cfg *apiConfig) introspectRefreshToken(r *http.Request, token string) introspectionResponse {
+	refreshToken, err := cfg.dbQueries.GetRefreshToken(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Println("error fetching refresh token for introspection: ", err)
+		}
+		return introspectionResponse{}
+	}
+	if refreshToken.RevokedAt.Valid || time.Now().After(refreshToken.ExpiresAt) {
+		return introspectionResponse{}
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), refreshToken.UserID)
+	if err != nil || user.SuspendedAt.Valid {
+		return introspectionResponse{}
+	}
+
+	return introspectionResponse{
+		Active:    true,
+		TokenType: "refresh_token",
+		Subject:   user.ID.String(),
+		Username:  user.Email,
+		Issuer:    "chirpy",
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+	}
+}
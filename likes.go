@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// likeChirp likes a chirp for the caller. Liking it again does nothing, the
+// likes table only ever holds one row per user and chirp.
+func (cfg *apiConfig) likeChirp(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to like chirp")
+		return
+	}
+	if cfg.respondIfHidden(w, r, user.ID, &chirp, "no chirp found with the requested ID") {
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithTombstone(w, &chirp)
+		return
+	}
+
+	created, err := cfg.dbQueries.CreateLike(r.Context(), database.CreateLikeParams{
+		UserID:  user.ID,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		fmt.Println("error creating like: ", err)
+		respondWithError(w, 500, "failed to like chirp")
+		return
+	}
+	if created > 0 {
+		cfg.notify(r.Context(), notification{
+			recipient: chirp.UserID,
+			actor:     user.ID,
+			kind:      notificationLike,
+			chirpID:   uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		})
+	}
+
+	cfg.respondWithChirp(w, r, user.ID, 200, &chirp)
+}
+
+func (cfg *apiConfig) unlikeChirp(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	err = cfg.dbQueries.DeleteLike(r.Context(), database.DeleteLikeParams{
+		UserID:  user.ID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		fmt.Println("error deleting like: ", err)
+		respondWithError(w, 500, "failed to unlike chirp")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getUserLikes lists the chirps a user liked, most recently liked first
+func (cfg *apiConfig) getUserLikes(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if cfg.respondIfBlocked(w, r, viewer, userID, "no user found with the requested ID") {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetLikedChirps(r.Context(), database.GetLikedChirpsParams{
+		UserID:   userID,
+		ViewerID: viewer,
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching liked chirps: ", err)
+		respondWithError(w, 500, "failed to fetch likes")
+		return
+	}
+
+	dbChirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		dbChirps = append(dbChirps, row.Chirp)
+	}
+
+	jsonChirps, err := cfg.chirpsToJSON(r.Context(), viewer, dbChirps)
+	if err != nil {
+		fmt.Println("error building chirps response: ", err)
+		respondWithError(w, 500, "failed to fetch likes")
+		return
+	}
+	respondWithJSON(w, 200, jsonChirps)
+}
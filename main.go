@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"strconv"
 	"sync/atomic"
 	"time"
 
 	"github.com/whatsmynameagain/go-chirpy/internal/auth"
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
 	"github.com/whatsmynameagain/go-chirpy/internal/database"
+	"github.com/whatsmynameagain/go-chirpy/internal/moderation"
+	"github.com/whatsmynameagain/go-chirpy/internal/realtime"
+	"github.com/whatsmynameagain/go-chirpy/internal/storage"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
@@ -32,11 +38,117 @@ func main() {
 	const rootDir = "./"
 	const port = "8080"
 
+	maxChirpLength := 140
+	if envLength := os.Getenv("MAX_CHIRP_LENGTH"); envLength != "" {
+		maxChirpLength, err = strconv.Atoi(envLength)
+		if err != nil || maxChirpLength <= 0 {
+			log.Fatal("MAX_CHIRP_LENGTH must be a positive integer")
+		}
+	}
+
+	// how long after posting a chirp can still be edited, 0 means forever
+	var chirpEditWindow time.Duration
+	if envWindow := os.Getenv("CHIRP_EDIT_WINDOW"); envWindow != "" {
+		chirpEditWindow, err = time.ParseDuration(envWindow)
+		if err != nil || chirpEditWindow < 0 {
+			log.Fatal("CHIRP_EDIT_WINDOW must be a duration, e.g. 15m")
+		}
+	}
+
+	// how long deleted chirps are kept around before being purged
+	chirpRetention := 30 * 24 * time.Hour
+	if envRetention := os.Getenv("CHIRP_RETENTION"); envRetention != "" {
+		chirpRetention, err = time.ParseDuration(envRetention)
+		if err != nil || chirpRetention < 0 {
+			log.Fatal("CHIRP_RETENTION must be a duration, e.g. 720h")
+		}
+	}
+
+	// accounts with more followers than this aren't fanned out on write,
+	// their chirps are merged into timelines when they're read
+	fanoutThreshold := 10000
+	if envThreshold := os.Getenv("FANOUT_FOLLOWER_THRESHOLD"); envThreshold != "" {
+		fanoutThreshold, err = strconv.Atoi(envThreshold)
+		if err != nil || fanoutThreshold < 0 {
+			log.Fatal("FANOUT_FOLLOWER_THRESHOLD must be a non-negative integer")
+		}
+	}
+
+	// how far back trending hashtags look, tags are ranked by how much they
+	// grew compared to the window before
+	trendingWindow := time.Hour
+	if envWindow := os.Getenv("TRENDING_WINDOW"); envWindow != "" {
+		trendingWindow, err = time.ParseDuration(envWindow)
+		if err != nil || trendingWindow <= 0 {
+			log.Fatal("TRENDING_WINDOW must be a positive duration, e.g. 1h")
+		}
+	}
+
+	fanoutWorkers := 2
+	if envWorkers := os.Getenv("FANOUT_WORKERS"); envWorkers != "" {
+		fanoutWorkers, err = strconv.Atoi(envWorkers)
+		if err != nil || fanoutWorkers <= 0 {
+			log.Fatal("FANOUT_WORKERS must be a positive integer")
+		}
+	}
+
+	maxUploadBytes := int64(5 << 20)
+	if envUpload := os.Getenv("MAX_UPLOAD_BYTES"); envUpload != "" {
+		maxUploadBytes, err = strconv.ParseInt(envUpload, 10, 64)
+		if err != nil || maxUploadBytes <= 0 {
+			log.Fatal("MAX_UPLOAD_BYTES must be a positive integer")
+		}
+	}
+
+	blobs, err := openBlobStorage()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	moderationConfig := os.Getenv("MODERATION_RULES")
+	if moderationConfig == "" {
+		moderationConfig = "moderation/rules.json"
+	}
+	pipeline, err := moderation.Load(moderationConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	apiCfg := &apiConfig{
-		maxChirpLength: 140,
-		dbQueries:      database.New(db),
-		secret:         env_secret,
+		maxChirpLength:  maxChirpLength,
+		chirpEditWindow: chirpEditWindow,
+		chirpRetention:  chirpRetention,
+		fanoutThreshold: int32(fanoutThreshold),
+		fanoutWake:      make(chan struct{}, 1),
+		trendingWindow:  trendingWindow,
+		events:          realtime.NewHub(streamBufferSize),
+		db:              db,
+		dbQueries:       database.New(db),
+		secret:          env_secret,
+		introspectionClients: parseIntrospectionClients(
+			os.Getenv("INTROSPECTION_CLIENTS"),
+		),
+		moderationConfig: moderationConfig,
+		blobs:            blobs,
+		maxUploadBytes:   maxUploadBytes,
 	} // fileserverHits default is 0, no need to initialize
+	apiCfg.moderation.Store(pipeline)
+
+	if len(os.Args) > 1 {
+		err = apiCfg.runCommand(context.Background(), os.Args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	go apiCfg.runChirpPurger(context.Background())
+	for range fanoutWorkers {
+		go apiCfg.runFanoutWorker(context.Background())
+	}
+	go apiCfg.runTrendingRefresher(context.Background())
+	go apiCfg.runEventListener(context.Background(), dbURL)
+	go apiCfg.runScheduler(context.Background())
 
 	newMux := http.NewServeMux()
 	serverStruct := &http.Server{
@@ -51,18 +163,86 @@ func main() {
 
 	// newMux.HandleFunc("POST /admin/reset", apiCfg.resetCountHandler)
 	newMux.HandleFunc("POST /admin/reset", apiCfg.resetUsers)
+	newMux.HandleFunc("POST /admin/moderation/reload", apiCfg.reloadModeration)
+	newMux.HandleFunc("POST /admin/chirps/{chirpID}/restore", apiCfg.restoreChirp)
+	newMux.HandleFunc("GET /admin/reports", apiCfg.listReports)
+	newMux.HandleFunc("GET /admin/reports/{reportID}", apiCfg.getReport)
+	newMux.HandleFunc("POST /admin/reports/{reportID}/claim", apiCfg.claimReport)
+	newMux.HandleFunc("POST /admin/reports/{reportID}/resolve", apiCfg.resolveReport)
 
 	newMux.HandleFunc("GET /api/healthz", readinessHandler)
 
 	//newMux.HandleFunc("POST /api/validate_chirp", apiCfg.validateChirpHandler)
 
 	newMux.HandleFunc("POST /api/users", apiCfg.createUser)
+	newMux.HandleFunc("GET /api/users/me", apiCfg.getCurrentUser)
+	newMux.HandleFunc("PUT /api/users/me", apiCfg.updateCurrentUser)
+	newMux.HandleFunc("GET /api/users/me/blocks", apiCfg.getBlocks)
+	newMux.HandleFunc("GET /api/users/me/mutes", apiCfg.getMutes)
+	newMux.HandleFunc("GET /api/users/me/follow_requests", apiCfg.listFollowRequests)
+	newMux.HandleFunc("POST /api/users/me/follow_requests/{userID}/accept", apiCfg.acceptFollowRequest)
+	newMux.HandleFunc("POST /api/users/me/follow_requests/{userID}/reject", apiCfg.rejectFollowRequest)
+	newMux.HandleFunc("GET /api/users/{userID}/chirps", apiCfg.getUserChirps)
+	newMux.HandleFunc("GET /api/users/{userID}/likes", apiCfg.getUserLikes)
+	newMux.HandleFunc("GET /api/users/{userID}/mentions", apiCfg.getUserMentions)
+	newMux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.followUser)
+	newMux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.unfollowUser)
+	newMux.HandleFunc("GET /api/users/{userID}/followers", apiCfg.getFollowers)
+	newMux.HandleFunc("GET /api/users/{userID}/following", apiCfg.getFollowing)
+	newMux.HandleFunc("POST /api/users/{userID}/block", apiCfg.blockUser)
+	newMux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.unblockUser)
+	newMux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.muteUser)
+	newMux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.unmuteUser)
+
+	newMux.HandleFunc("GET /api/timeline", apiCfg.getTimeline)
+	newMux.HandleFunc("GET /api/stream", apiCfg.streamEvents)
+	newMux.HandleFunc("GET /api/ws", apiCfg.serveSocket)
+	newMux.HandleFunc("GET /api/notifications", apiCfg.listNotifications)
+	newMux.HandleFunc("GET /api/notifications/unread_count", apiCfg.getUnreadNotificationCount)
+	newMux.HandleFunc("POST /api/notifications/read", apiCfg.markAllNotificationsRead)
+	newMux.HandleFunc("POST /api/notifications/{notificationID}/read", apiCfg.markNotificationRead)
+	newMux.HandleFunc("GET /api/notifications/preferences", apiCfg.getNotificationPreferences)
+	newMux.HandleFunc("PUT /api/notifications/preferences", apiCfg.updateNotificationPreferences)
+	newMux.HandleFunc("POST /api/conversations", apiCfg.createConversation)
+	newMux.HandleFunc("GET /api/conversations", apiCfg.listConversations)
+	newMux.HandleFunc("GET /api/conversations/{conversationID}", apiCfg.getConversation)
+	newMux.HandleFunc("POST /api/conversations/{conversationID}/messages", apiCfg.sendMessage)
+	newMux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.getMessages)
+	newMux.HandleFunc("POST /api/conversations/{conversationID}/read", apiCfg.markConversationRead)
+	newMux.HandleFunc("GET /api/search", apiCfg.searchHandler)
+	newMux.HandleFunc("GET /api/hashtags/trending", apiCfg.getTrendingHashtags)
+	newMux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.getHashtagChirps)
 
 	newMux.HandleFunc("POST /api/chirps", apiCfg.createChirp)
 	newMux.HandleFunc("GET /api/chirps", apiCfg.getAllChirps)
+	newMux.HandleFunc("POST /api/drafts", apiCfg.createDraft)
+	newMux.HandleFunc("GET /api/drafts", apiCfg.listDrafts)
+	newMux.HandleFunc("GET /api/drafts/{draftID}", apiCfg.getDraft)
+	newMux.HandleFunc("PUT /api/drafts/{draftID}", apiCfg.updateDraft)
+	newMux.HandleFunc("DELETE /api/drafts/{draftID}", apiCfg.deleteDraft)
+	newMux.HandleFunc("POST /api/drafts/{draftID}/check", apiCfg.checkDraft)
+	newMux.HandleFunc("POST /api/drafts/{draftID}/publish", apiCfg.publishDraft)
+	newMux.HandleFunc("GET /api/scheduled_chirps", apiCfg.listScheduledChirps)
+	newMux.HandleFunc("PUT /api/scheduled_chirps/{scheduledID}", apiCfg.rescheduleChirp)
+	newMux.HandleFunc("DELETE /api/scheduled_chirps/{scheduledID}", apiCfg.cancelScheduledChirp)
 	newMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirp)
+	newMux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.editChirp)
+	newMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirp)
+	newMux.HandleFunc("GET /api/chirps/{chirpID}/history", apiCfg.getChirpHistory)
+	newMux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.getThread)
+	newMux.HandleFunc("POST /api/chirps/{chirpID}/reports", apiCfg.createReport)
+	newMux.HandleFunc("POST /api/chirps/{chirpID}/rechirps", apiCfg.rechirp)
+	newMux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirps", apiCfg.unrechirp)
+	newMux.HandleFunc("POST /api/chirps/{chirpID}/likes", apiCfg.likeChirp)
+	newMux.HandleFunc("DELETE /api/chirps/{chirpID}/likes", apiCfg.unlikeChirp)
+	newMux.HandleFunc("POST /api/chirps/{chirpID}/poll/votes", apiCfg.voteInPoll)
+
+	newMux.HandleFunc("POST /api/attachments", apiCfg.uploadAttachment)
+	newMux.HandleFunc("GET /api/attachments/{attachmentID}", apiCfg.getAttachment)
+	newMux.HandleFunc("GET /api/attachments/{attachmentID}/thumbnail", apiCfg.getAttachmentThumbnail)
 
 	newMux.HandleFunc("POST /api/login", apiCfg.loginHandler)
+	newMux.HandleFunc("POST /api/tokens/introspect", apiCfg.introspectToken)
 
 	log.Printf("Serving %s on :%s\n", rootDir, port)
 	err = serverStruct.ListenAndServe()
@@ -83,10 +263,29 @@ func readinessHandler(w http.ResponseWriter, _ *http.Request) {
 }
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	maxChirpLength uint8 //test
-	dbQueries      *database.Queries
-	secret         string
+	fileserverHits  atomic.Int32
+	maxChirpLength  int
+	chirpEditWindow time.Duration
+	chirpRetention  time.Duration
+	db              *sql.DB
+	dbQueries       *database.Queries
+	secret          string
+	// client id -> secret, for callers of the introspection endpoint
+	introspectionClients map[string]string
+	// swapped out as a whole when an admin reloads the rules
+	moderation       atomic.Pointer[moderation.Pipeline]
+	moderationConfig string
+	// accounts with more followers than this are merged in at read time
+	// instead of fanned out
+	fanoutThreshold int32
+	// signalled after a chirp is queued for fan-out
+	fanoutWake     chan struct{}
+	trendingWindow time.Duration
+	// realtime events for this instance's streams, fed by runEventListener
+	events *realtime.Hub
+	// where attachments are kept, nil when uploads are turned off
+	blobs          storage.Storage
+	maxUploadBytes int64
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -120,34 +319,41 @@ func (cfg *apiConfig) resetCountHandler(w http.ResponseWriter, _ *http.Request)
 
 // gonna keep adding the handler functions here for now
 
-func checkProfanity(txt string, censor string, profanityList []string) []string {
-
-	words := strings.Split(txt, " ")
-	for i, n := range words {
-		for _, p := range profanityList {
-			if strings.EqualFold(n, p) {
-				words[i] = censor
-			}
-		}
-	}
-	return words
-}
-
 type User struct {
 	Id        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Email     string    `json:"email"`
+	Handle    string    `json:"handle"`
+	Protected bool      `json:"protected"`
 	Password  string    `json:"password,omitempty"`
 	Token     string    `json:"token"`
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Visibility string     `json:"visibility"`
+	InReplyTo  *uuid.UUID `json:"in_reply_to,omitempty"`
+	RootID     *uuid.UUID `json:"root_id,omitempty"`
+	ReplyCount int64      `json:"reply_count"`
+
+	QuoteOf      *uuid.UUID   `json:"quote_of,omitempty"`
+	QuotedChirp  *QuotedChirp `json:"quoted_chirp,omitempty"`
+	RechirpCount int64        `json:"rechirp_count"`
+	QuoteCount   int64        `json:"quote_count"`
+	LikeCount    int64        `json:"like_count"`
+	LikedByMe    bool         `json:"liked_by_me"`
+
+	Mentions    []MentionEntity `json:"mentions,omitempty"`
+	Attachments []Attachment    `json:"attachments,omitempty"`
+	Poll        *Poll           `json:"poll,omitempty"`
+	// set when the chirp shows up in a listing because someone rechirped it
+	RechirpedBy *uuid.UUID `json:"rechirped_by,omitempty"`
+	RechirpedAt *time.Time `json:"rechirped_at,omitempty"`
 }
 
 func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
@@ -155,6 +361,7 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 	type usrReq struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Handle   string `json:"handle"`
 	}
 
 	data, err := io.ReadAll(r.Body)
@@ -170,6 +377,13 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if usrData.Handle == "" {
+		usrData.Handle = defaultHandle()
+	} else if err = chirptext.ValidateHandle(usrData.Handle); err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
 	hashed_pw, err := auth.HashPassword(usrData.Password)
 	if err != nil {
 		fmt.Println("Error hashing password: ", err)
@@ -178,10 +392,15 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 	usrParam := database.CreateUserParams{
 		Email:          usrData.Email,
 		HashedPassword: hashed_pw,
+		Handle:         usrData.Handle,
 	}
 
 	user, err := cfg.dbQueries.CreateUser(r.Context(), usrParam)
 	if err != nil {
+		if isHandleTaken(err) {
+			respondWithError(w, 409, "handle is already taken")
+			return
+		}
 		fmt.Println("error: ", err)
 		respondWithError(w, 500, "could not create user")
 		return
@@ -192,6 +411,7 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email:     user.Email,
+		Handle:    user.Handle,
 		// do not include pw in the response
 		// Password: 	user.HashedPassword,
 	}
@@ -216,8 +436,9 @@ func (cfg *apiConfig) resetUsers(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	type chirpReq struct {
-		Body   string    `json:"body"`
-		UserID uuid.UUID `json:"user_id"`
+		chirpRequest
+		// a time in the future schedules the chirp instead, see scheduled.go
+		PublishAt *time.Time `json:"publish_at"`
 	}
 
 	data, err := io.ReadAll(r.Body)
@@ -226,17 +447,12 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString, err := auth.GetBearerToken(r.Header)
+	author, err := cfg.authenticate(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "could not read JWT")
+		respondWithAuthError(w, err)
 		return
 	}
 
-	userUUID, err := auth.ValidateJWT(tokenString, cfg.secret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "could not validate JWT")
-	}
-
 	chirpData := chirpReq{}
 	err = json.Unmarshal(data, &chirpData)
 	if err != nil {
@@ -244,107 +460,82 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check length
-	if len(chirpData.Body) > int(cfg.maxChirpLength) {
-		msg := fmt.Sprintf("chirp is too long (max: %d)", cfg.maxChirpLength)
-		err = respondWithError(w, 400, msg)
-		if err != nil {
-			fmt.Println("error responding: ", err)
-		}
-		return
-	}
-
-	// check profanity
-	profList := []string{"kerfuffle", "sharbert", "fornax"}
-	censor := "****"
-	words := checkProfanity(chirpData.Body, censor, profList)
-
-	cleanedBody := strings.Join(words, " ")
-	newChirp := database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: userUUID,
-	}
+	cfg.postChirp(w, r, author.ID, &chirpData.chirpRequest, chirpData.PublishAt, nil)
+}
 
-	newChirpDB, err := cfg.dbQueries.CreateChirp(r.Context(), newChirp)
+func (cfg *apiConfig) getAllChirps(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
 	if err != nil {
-		fmt.Println("error creating chirp: ", err)
-		respondWithError(w, 500, "failed to create chirp")
+		respondWithAuthError(w, err)
 		return
 	}
 
-	responseChirp := Chirp{
-		ID:        newChirpDB.ID,
-		CreatedAt: newChirpDB.CreatedAt,
-		UpdatedAt: newChirpDB.UpdatedAt,
-		Body:      newChirpDB.Body,
-		UserID:    newChirpDB.UserID,
-	}
-	err = respondWithJSON(w, 201, responseChirp)
+	dbChirps, err := cfg.dbQueries.GetAllChirps(r.Context(), viewer)
 	if err != nil {
-		fmt.Println("error sending response: ", err)
+		respondWithError(w, 500, "failed to fetch chirps")
+		return
 	}
-}
-
-func (cfg *apiConfig) getAllChirps(w http.ResponseWriter, r *http.Request) {
 
-	dbChirps, err := cfg.dbQueries.GetAllChirps(r.Context())
+	jsonChirps, err := cfg.chirpsToJSON(r.Context(), viewer, dbChirps)
 	if err != nil {
+		fmt.Println("error building chirps response: ", err)
 		respondWithError(w, 500, "failed to fetch chirps")
-	}
-	// if empty
-	if len(dbChirps) == 0 {
-		respondWithJSON(w, 200, []Chirp{})
 		return
 	}
 
-	jsonChirps := []Chirp{}
-	for _, dbChirp := range dbChirps {
-		chirp := dbChirpToJSONChirp(&dbChirp)
-		jsonChirps = append(jsonChirps, chirp)
-	}
-
 	respondWithJSON(w, 200, jsonChirps)
 
 }
 
 func (cfg *apiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		// debug for now, replace with http response
-		fmt.Println("error converting endpoint uuid string into uuid: ", err)
+		respondWithError(w, 400, "invalid chirp ID")
 		return
 	}
 
 	fetchedChirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
 	if err != nil {
-		// debug for now, replace with http response
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
 		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to fetch chirp")
 		return
 	}
-
-	// if empty
-	if fetchedChirp == (database.Chirp{}) {
-		respondWithError(w, 404, "no chirp found with the requested ID")
+	if cfg.respondIfHidden(w, r, viewer, &fetchedChirp, "no chirp found with the requested ID") {
 		return
 	}
 
-	returnChirp := dbChirpToJSONChirp(&fetchedChirp)
-	err = respondWithJSON(w, 200, returnChirp)
-	if err != nil {
-		fmt.Println("error responding: ", err)
+	if fetchedChirp.DeletedAt.Valid {
+		respondWithTombstone(w, &fetchedChirp)
+		return
 	}
 
+	cfg.respondWithChirp(w, r, viewer, 200, &fetchedChirp)
+
 }
 
 func dbChirpToJSONChirp(chrp *database.Chirp) Chirp {
 	// gotta do this because the database.Chirps struct doesn't have the JSON tags,
 	// making the JSON keys be capitalized by the marshalling
 	return Chirp{
-		ID:        chrp.ID,
-		CreatedAt: chrp.CreatedAt,
-		UpdatedAt: chrp.UpdatedAt,
-		Body:      chrp.Body,
-		UserID:    chrp.UserID,
+		ID:         chrp.ID,
+		CreatedAt:  chrp.CreatedAt,
+		UpdatedAt:  chrp.UpdatedAt,
+		Body:       chrp.Body,
+		UserID:     chrp.UserID,
+		Visibility: chrp.Visibility,
+		InReplyTo:  nullUUIDPtr(chrp.InReplyTo),
+		RootID:     nullUUIDPtr(chrp.RootID),
+		QuoteOf:    nullUUIDPtr(chrp.QuoteOf),
 	}
 
 }
@@ -390,6 +581,10 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 401, "incorrect user or password")
 		return
 	}
+	if userInfo.SuspendedAt.Valid {
+		respondWithError(w, 403, errAccountSuspended.Error())
+		return
+	}
 
 	new_token, err := auth.MakeJWT(userInfo.ID, cfg.secret, time.Duration(expirationTime)*time.Second)
 	if err != nil {
@@ -401,6 +596,8 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: userInfo.CreatedAt,
 		UpdatedAt: userInfo.UpdatedAt,
 		Email:     userInfo.Email,
+		Handle:    userInfo.Handle,
+		Protected: userInfo.Protected,
 		Token:     new_token,
 	})
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// MentionEntity is an @handle in a chirp body that resolved to a user. Start
+// and End are code point offsets into the body, End exclusive, and cover the
+// @ too.
+type MentionEntity struct {
+	UserID uuid.UUID `json:"user_id"`
+	Handle string    `json:"handle"`
+	Start  int       `json:"start"`
+	End    int       `json:"end"`
+}
+
+// notifyMentioned notifies the users mentioned in a chirp, except skip and
+// anyone who isn't allowed to see the chirp
+func (cfg *apiConfig) notifyMentioned(ctx context.Context, chrp *database.Chirp, mentioned []uuid.UUID, skip uuid.UUID) {
+	for _, userID := range mentioned {
+		if userID == skip {
+			continue
+		}
+		visible, err := cfg.canViewChirp(ctx, userID, chrp)
+		if err != nil {
+			fmt.Println("error checking chirp visibility: ", err)
+		}
+		if !visible {
+			continue
+		}
+		cfg.notify(ctx, notification{
+			recipient: userID,
+			actor:     chrp.UserID,
+			kind:      notificationMention,
+			chirpID:   uuid.NullUUID{UUID: chrp.ID, Valid: true},
+		})
+	}
+}
+
+// saveMentions replaces the stored mentions of a chirp with the ones in its
+// current body and returns who's mentioned. Handles that don't exist, and
+// users blocked either way with the author, are left as plain text.
+func saveMentions(ctx context.Context, qtx *database.Queries, chrp *database.Chirp) ([]uuid.UUID, error) {
+	err := qtx.DeleteChirpMentions(ctx, chrp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var handles []string
+	seen := map[string]bool{}
+	for _, mention := range chirptext.Mentions(chrp.Body) {
+		handle := chirptext.NormalizeHandle(mention.Handle)
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+	if len(handles) == 0 {
+		return nil, nil
+	}
+
+	users, err := qtx.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return nil, err
+	}
+	blockedIDs, err := qtx.GetBlockedUserIDs(ctx, chrp.UserID)
+	if err != nil {
+		return nil, err
+	}
+	blocked := make(map[uuid.UUID]bool, len(blockedIDs))
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
+
+	params := database.CreateChirpMentionsParams{
+		ChirpID:   chrp.ID,
+		CreatedAt: chrp.CreatedAt,
+	}
+	for i := range users {
+		if blocked[users[i].ID] {
+			continue
+		}
+		params.UserIds = append(params.UserIds, users[i].ID)
+		params.Handles = append(params.Handles, chirptext.NormalizeHandle(users[i].Handle))
+	}
+	if len(params.UserIds) == 0 {
+		return nil, nil
+	}
+	return params.UserIds, qtx.CreateChirpMentions(ctx, params)
+}
+
+// mentionEntities finds the mentions in a body again and keeps the ones that
+// were resolved when it was saved
+func mentionEntities(body string, resolved []database.ChirpMention) []MentionEntity {
+	if len(resolved) == 0 {
+		return nil
+	}
+	users := make(map[string]uuid.UUID, len(resolved))
+	for _, m := range resolved {
+		users[m.Handle] = m.UserID
+	}
+
+	var entities []MentionEntity
+	for _, mention := range chirptext.Mentions(body) {
+		userID, ok := users[chirptext.NormalizeHandle(mention.Handle)]
+		if !ok {
+			continue
+		}
+		entities = append(entities, MentionEntity{
+			UserID: userID,
+			Handle: mention.Handle,
+			Start:  mention.Start,
+			End:    mention.End,
+		})
+	}
+	return entities
+}
+
+// getUserMentions lists the chirps mentioning a user, newest first
+func (cfg *apiConfig) getUserMentions(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if cfg.respondIfBlocked(w, r, viewer, userID, "no user found with the requested ID") {
+		return
+	}
+
+	limit, after, err := parseKeysetPagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	dbChirps, err := cfg.dbQueries.GetMentionChirps(r.Context(), database.GetMentionChirpsParams{
+		UserID:          userID,
+		BeforeCreatedAt: after.CreatedAt,
+		BeforeID:        after.ID,
+		ViewerID:        viewer,
+		PageLimit:       limit,
+	})
+	if err != nil {
+		fmt.Println("error fetching mentions: ", err)
+		respondWithError(w, 500, "failed to fetch mentions")
+		return
+	}
+
+	cfg.respondWithChirpPage(w, r, viewer, dbChirps, limit)
+}
+
+// updateCurrentUser changes the caller's profile: the handle and whether the
+// account is protected. Fields left out stay as they are.
+func (cfg *apiConfig) updateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type updateReq struct {
+		Handle    *string `json:"handle"`
+		Protected *bool   `json:"protected"`
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	update := updateReq{}
+	err = json.Unmarshal(data, &update)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+	if update.Handle == nil && update.Protected == nil {
+		respondWithError(w, 400, "nothing to update")
+		return
+	}
+	if update.Handle != nil {
+		err = chirptext.ValidateHandle(*update.Handle)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to update user")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	updated := user
+	if update.Handle != nil {
+		updated, err = qtx.UpdateUserHandle(r.Context(), database.UpdateUserHandleParams{
+			ID:     user.ID,
+			Handle: *update.Handle,
+		})
+		if err != nil {
+			if isUniqueViolation(err) {
+				respondWithError(w, 409, "handle is already taken")
+				return
+			}
+			fmt.Println("error updating user: ", err)
+			respondWithError(w, 500, "failed to update user")
+			return
+		}
+	}
+	var accepted []uuid.UUID
+	if update.Protected != nil && *update.Protected != user.Protected {
+		updated, err = qtx.SetUserProtected(r.Context(), database.SetUserProtectedParams{
+			ID:        user.ID,
+			Protected: *update.Protected,
+		})
+		if err == nil && !updated.Protected {
+			accepted, err = cfg.acceptAllFollowRequests(r.Context(), qtx, &updated)
+		}
+		if err != nil {
+			fmt.Println("error updating user: ", err)
+			respondWithError(w, 500, "failed to update user")
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing user update: ", err)
+		respondWithError(w, 500, "failed to update user")
+		return
+	}
+	for _, requesterID := range accepted {
+		cfg.notify(r.Context(), notification{
+			recipient: requesterID,
+			actor:     user.ID,
+			kind:      notificationFollowAccepted,
+		})
+	}
+
+	err = respondWithJSON(w, 200, User{
+		Id:        updated.ID,
+		CreatedAt: updated.CreatedAt,
+		UpdatedAt: updated.UpdatedAt,
+		Email:     updated.Email,
+		Handle:    updated.Handle,
+		Protected: updated.Protected,
+	})
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
+
+// defaultHandle is given to users who sign up without picking one
+func defaultHandle() string {
+	id := uuid.New()
+	return fmt.Sprintf("user_%x", id[:5])
+}
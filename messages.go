@@ -0,0 +1,638 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// direct messages live in conversations, either one-to-one (a pair of users
+// only ever has one) or small groups, and only members can see them. A block
+// keeps two users from starting or carrying on a one-to-one conversation;
+// in a group it hides what each of them sends from the other.
+
+const (
+	// everyone in a group, the creator included
+	maxConversationMembers = 10
+	maxMessageLength       = 1000
+)
+
+type ConversationMember struct {
+	ID       uuid.UUID `json:"id"`
+	Handle   string    `json:"handle"`
+	JoinedAt time.Time `json:"joined_at"`
+	// the member's read receipt
+	LastReadMessageID *uuid.UUID `json:"last_read_message_id,omitempty"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"`
+}
+
+type Conversation struct {
+	ID            uuid.UUID            `json:"id"`
+	IsGroup       bool                 `json:"is_group"`
+	CreatedAt     time.Time            `json:"created_at"`
+	LastMessageAt time.Time            `json:"last_message_at"`
+	Members       []ConversationMember `json:"members"`
+	LastMessage   *Message             `json:"last_message,omitempty"`
+	// messages from others since the caller's read receipt
+	UnreadCount int64 `json:"unread_count"`
+}
+
+type ConversationList struct {
+	Conversations []Conversation `json:"conversations"`
+}
+
+type Message struct {
+	ID             uuid.UUID `json:"id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type ReadReceipt struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	ReadAt         time.Time `json:"read_at"`
+}
+
+func dbMessageToJSON(m *database.Message) Message {
+	return Message{
+		ID:             m.ID,
+		ConversationID: m.ConversationID,
+		SenderID:       m.SenderID,
+		Body:           m.Body,
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+// directKey names the one-to-one conversation between two users, the same
+// whichever of them asks
+func directKey(a, b uuid.UUID) string {
+	if a.String() > b.String() {
+		a, b = b, a
+	}
+	return a.String() + ":" + b.String()
+}
+
+// conversationForMember loads a conversation the user is in. A one-to-one
+// conversation where the other member is blocked either way (or gone) is
+// treated as not found, the same as ListConversations leaves it out.
+func (cfg *apiConfig) conversationForMember(ctx context.Context, conversationID, userID uuid.UUID) (database.Conversation, error) {
+	conv, err := cfg.dbQueries.GetMemberConversation(ctx, database.GetMemberConversationParams{
+		ID:     conversationID,
+		UserID: userID,
+	})
+	if err != nil {
+		return database.Conversation{}, err
+	}
+	if conv.DirectKey.Valid {
+		recipients, err := cfg.dbQueries.GetConversationRecipients(ctx, database.GetConversationRecipientsParams{
+			ConversationID: conv.ID,
+			UserID:         userID,
+		})
+		if err != nil {
+			return database.Conversation{}, err
+		}
+		if len(recipients) == 0 {
+			return database.Conversation{}, sql.ErrNoRows
+		}
+	}
+	return conv, nil
+}
+
+// conversationsToJSON fills in the members, the latest message and the
+// unread count, one query each for the whole list
+func (cfg *apiConfig) conversationsToJSON(ctx context.Context, viewer uuid.UUID, rows []database.Conversation) ([]Conversation, error) {
+	conversations := make([]Conversation, 0, len(rows))
+	if len(rows) == 0 {
+		return conversations, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(rows))
+	for i := range rows {
+		ids = append(ids, rows[i].ID)
+	}
+
+	memberRows, err := cfg.dbQueries.GetConversationMembers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[uuid.UUID][]ConversationMember, len(rows))
+	for _, m := range memberRows {
+		members[m.ConversationID] = append(members[m.ConversationID], ConversationMember{
+			ID:                m.ID,
+			Handle:            m.Handle,
+			JoinedAt:          m.JoinedAt,
+			LastReadMessageID: nullUUIDPtr(m.LastReadMessageID),
+			LastReadAt:        nullTimePtr(m.LastReadAt),
+		})
+	}
+
+	latestRows, err := cfg.dbQueries.GetLatestMessages(ctx, database.GetLatestMessagesParams{
+		ConversationIds: ids,
+		ViewerID:        viewer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[uuid.UUID]*Message, len(latestRows))
+	for i := range latestRows {
+		msg := dbMessageToJSON(&latestRows[i])
+		latest[msg.ConversationID] = &msg
+	}
+
+	unreadRows, err := cfg.dbQueries.CountUnreadMessages(ctx, database.CountUnreadMessagesParams{
+		ViewerID:        viewer,
+		ConversationIds: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+	unread := make(map[uuid.UUID]int64, len(unreadRows))
+	for _, u := range unreadRows {
+		unread[u.ConversationID] = u.UnreadCount
+	}
+
+	for i := range rows {
+		conversations = append(conversations, Conversation{
+			ID:            rows[i].ID,
+			IsGroup:       !rows[i].DirectKey.Valid,
+			CreatedAt:     rows[i].CreatedAt,
+			LastMessageAt: rows[i].LastMessageAt,
+			Members:       members[rows[i].ID],
+			LastMessage:   latest[rows[i].ID],
+			UnreadCount:   unread[rows[i].ID],
+		})
+	}
+	return conversations, nil
+}
+
+func (cfg *apiConfig) respondWithConversation(w http.ResponseWriter, r *http.Request, viewer uuid.UUID, code int, conv *database.Conversation) {
+	conversations, err := cfg.conversationsToJSON(r.Context(), viewer, []database.Conversation{*conv})
+	if err != nil {
+		fmt.Println("error building conversation response: ", err)
+		respondWithError(w, 500, "failed to build conversation response")
+		return
+	}
+	respondWithJSON(w, code, conversations[0])
+}
+
+// createConversation starts a conversation with the given users, a group if
+// there's more than one. Asking for a one-to-one conversation that already
+// exists returns it instead (200 rather than 201).
+func (cfg *apiConfig) createConversation(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type conversationReq struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+	}
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+	convData := conversationReq{}
+	err = json.Unmarshal(data, &convData)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+
+	others := []uuid.UUID{}
+	for _, userID := range convData.UserIDs {
+		if userID != user.ID && !slices.Contains(others, userID) {
+			others = append(others, userID)
+		}
+	}
+	if len(others) == 0 {
+		respondWithError(w, 400, "a conversation needs at least one other user")
+		return
+	}
+	if len(others)+1 > maxConversationMembers {
+		respondWithError(w, 400, fmt.Sprintf("a conversation can have at most %d members", maxConversationMembers))
+		return
+	}
+
+	for _, userID := range others {
+		_, err = cfg.dbQueries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, 404, fmt.Sprintf("no user found with ID %s", userID))
+				return
+			}
+			fmt.Println("error fetching user: ", err)
+			respondWithError(w, 500, "failed to create conversation")
+			return
+		}
+		blocked, err := cfg.blockedBetween(r.Context(), user.ID, userID)
+		if err != nil {
+			fmt.Println("error checking blocks: ", err)
+			respondWithError(w, 500, "failed to create conversation")
+			return
+		}
+		if blocked {
+			respondWithError(w, 403, "you can't message this user")
+			return
+		}
+	}
+
+	var key sql.NullString
+	if len(others) == 1 {
+		key = sql.NullString{String: directKey(user.ID, others[0]), Valid: true}
+		existing, err := cfg.dbQueries.GetConversationByDirectKey(r.Context(), key)
+		if err == nil {
+			cfg.respondWithConversation(w, r, user.ID, 200, &existing)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Println("error fetching conversation: ", err)
+			respondWithError(w, 500, "failed to create conversation")
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to create conversation")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	conv, err := qtx.CreateConversation(r.Context(), database.CreateConversationParams{
+		DirectKey: key,
+		CreatedBy: uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// the other user started it at the same moment
+		tx.Rollback()
+		existing, err := cfg.dbQueries.GetConversationByDirectKey(r.Context(), key)
+		if err != nil {
+			fmt.Println("error fetching conversation: ", err)
+			respondWithError(w, 500, "failed to create conversation")
+			return
+		}
+		cfg.respondWithConversation(w, r, user.ID, 200, &existing)
+		return
+	}
+	if err != nil {
+		fmt.Println("error creating conversation: ", err)
+		respondWithError(w, 500, "failed to create conversation")
+		return
+	}
+
+	err = qtx.AddConversationMembers(r.Context(), database.AddConversationMembersParams{
+		ConversationID: conv.ID,
+		UserIds:        append(others, user.ID),
+	})
+	if err != nil {
+		fmt.Println("error adding conversation members: ", err)
+		respondWithError(w, 500, "failed to create conversation")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing conversation: ", err)
+		respondWithError(w, 500, "failed to create conversation")
+		return
+	}
+
+	cfg.respondWithConversation(w, r, user.ID, 201, &conv)
+}
+
+// listConversations is the caller's inbox, latest activity first
+func (cfg *apiConfig) listConversations(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.ListConversations(r.Context(), database.ListConversationsParams{
+		UserID: user.ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching conversations: ", err)
+		respondWithError(w, 500, "failed to fetch conversations")
+		return
+	}
+
+	conversations, err := cfg.conversationsToJSON(r.Context(), user.ID, rows)
+	if err != nil {
+		fmt.Println("error building conversations: ", err)
+		respondWithError(w, 500, "failed to fetch conversations")
+		return
+	}
+	respondWithJSON(w, 200, ConversationList{Conversations: conversations})
+}
+
+// memberConversationFromPath authenticates the caller and loads the
+// conversation in the path, answering the request itself when either fails
+func (cfg *apiConfig) memberConversationFromPath(w http.ResponseWriter, r *http.Request) (database.User, database.Conversation, bool) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return database.User{}, database.Conversation{}, false
+	}
+
+	conversationID, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid conversation ID")
+		return database.User{}, database.Conversation{}, false
+	}
+
+	conv, err := cfg.conversationForMember(r.Context(), conversationID, user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no conversation found with the requested ID")
+			return database.User{}, database.Conversation{}, false
+		}
+		fmt.Println("error fetching conversation: ", err)
+		respondWithError(w, 500, "failed to fetch conversation")
+		return database.User{}, database.Conversation{}, false
+	}
+	return user, conv, true
+}
+
+func (cfg *apiConfig) getConversation(w http.ResponseWriter, r *http.Request) {
+	user, conv, ok := cfg.memberConversationFromPath(w, r)
+	if !ok {
+		return
+	}
+	cfg.respondWithConversation(w, r, user.ID, 200, &conv)
+}
+
+// sendMessage posts a message to a conversation. Sending also moves the
+// sender's read receipt up to their own message.
+func (cfg *apiConfig) sendMessage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type messageReq struct {
+		Body string `json:"body"`
+	}
+
+	user, conv, ok := cfg.memberConversationFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+	msgData := messageReq{}
+	err = json.Unmarshal(data, &msgData)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+	if strings.TrimSpace(msgData.Body) == "" {
+		respondWithError(w, 400, "message can't be empty")
+		return
+	}
+	if length := chirptext.Length(msgData.Body); length > maxMessageLength {
+		respondWithError(w, 400, fmt.Sprintf("message is too long (length: %d, max: %d)", length, maxMessageLength))
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to send message")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	msg, err := qtx.CreateMessage(r.Context(), database.CreateMessageParams{
+		ConversationID: conv.ID,
+		SenderID:       user.ID,
+		Body:           msgData.Body,
+	})
+	if err != nil {
+		fmt.Println("error creating message: ", err)
+		respondWithError(w, 500, "failed to send message")
+		return
+	}
+	err = qtx.TouchConversation(r.Context(), database.TouchConversationParams{
+		LastMessageAt: msg.CreatedAt,
+		ID:            conv.ID,
+	})
+	if err == nil {
+		_, err = qtx.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+			ConversationID: conv.ID,
+			UserID:         user.ID,
+			MessageID:      msg.ID,
+		})
+	}
+	if err != nil {
+		fmt.Println("error updating conversation: ", err)
+		respondWithError(w, 500, "failed to send message")
+		return
+	}
+
+	recipients, err := qtx.GetConversationRecipients(r.Context(), database.GetConversationRecipientsParams{
+		ConversationID: conv.ID,
+		UserID:         user.ID,
+	})
+	if err == nil {
+		// the sender too, for their other devices
+		err = publishEvent(r.Context(), qtx, eventMessageCreated, messageEvent{
+			MessageID:  msg.ID,
+			Recipients: append(recipients, user.ID),
+		})
+	}
+	if err != nil {
+		fmt.Println("error publishing message event: ", err)
+		respondWithError(w, 500, "failed to send message")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing message: ", err)
+		respondWithError(w, 500, "failed to send message")
+		return
+	}
+	respondWithJSON(w, 201, dbMessageToJSON(&msg))
+}
+
+// getMessages is a conversation's history, newest first
+func (cfg *apiConfig) getMessages(w http.ResponseWriter, r *http.Request) {
+	user, conv, ok := cfg.memberConversationFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	limit, after, err := parseKeysetPagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetMessages(r.Context(), database.GetMessagesParams{
+		ConversationID:  conv.ID,
+		BeforeCreatedAt: after.CreatedAt,
+		BeforeID:        after.ID,
+		ViewerID:        user.ID,
+		PageLimit:       limit,
+	})
+	if err != nil {
+		fmt.Println("error fetching messages: ", err)
+		respondWithError(w, 500, "failed to fetch messages")
+		return
+	}
+
+	page := MessagePage{Messages: make([]Message, 0, len(rows))}
+	for i := range rows {
+		page.Messages = append(page.Messages, dbMessageToJSON(&rows[i]))
+	}
+	if len(rows) == int(limit) {
+		last := rows[len(rows)-1]
+		page.NextCursor = cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+	}
+	respondWithJSON(w, 200, page)
+}
+
+// markConversationRead moves the caller's read receipt up to a message,
+// {"message_id": ...}, or to the newest one when no message is given. The
+// other members are told over the realtime channels.
+func (cfg *apiConfig) markConversationRead(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type readReq struct {
+		MessageID *uuid.UUID `json:"message_id"`
+	}
+
+	user, conv, ok := cfg.memberConversationFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+	readData := readReq{}
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &readData)
+		if err != nil {
+			respondWithError(w, 400, "could not unmarshal data")
+			return
+		}
+	}
+
+	var messageID uuid.UUID
+	if readData.MessageID != nil {
+		msg, err := cfg.dbQueries.GetMessageByID(r.Context(), *readData.MessageID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			fmt.Println("error fetching message: ", err)
+			respondWithError(w, 500, "failed to mark conversation read")
+			return
+		}
+		if err != nil || msg.ConversationID != conv.ID {
+			respondWithError(w, 404, "no message found with the requested ID")
+			return
+		}
+		messageID = msg.ID
+	} else {
+		start := firstPageCursor
+		newest, err := cfg.dbQueries.GetMessages(r.Context(), database.GetMessagesParams{
+			ConversationID:  conv.ID,
+			BeforeCreatedAt: start.CreatedAt,
+			BeforeID:        start.ID,
+			ViewerID:        user.ID,
+			PageLimit:       1,
+		})
+		if err != nil {
+			fmt.Println("error fetching messages: ", err)
+			respondWithError(w, 500, "failed to mark conversation read")
+			return
+		}
+		if len(newest) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		messageID = newest[0].ID
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to mark conversation read")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	moved, err := qtx.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conv.ID,
+		UserID:         user.ID,
+		MessageID:      messageID,
+	})
+	if err != nil {
+		fmt.Println("error marking conversation read: ", err)
+		respondWithError(w, 500, "failed to mark conversation read")
+		return
+	}
+	// already read further than that, nothing to tell anyone
+	if moved == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	recipients, err := qtx.GetConversationRecipients(r.Context(), database.GetConversationRecipientsParams{
+		ConversationID: conv.ID,
+		UserID:         user.ID,
+	})
+	if err == nil {
+		err = publishEvent(r.Context(), qtx, eventConversationRead, readReceiptEvent{
+			ReadReceipt: ReadReceipt{
+				ConversationID: conv.ID,
+				UserID:         user.ID,
+				MessageID:      messageID,
+				ReadAt:         time.Now().UTC(),
+			},
+			Recipients: append(recipients, user.ID),
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		fmt.Println("error publishing read receipt: ", err)
+		respondWithError(w, 500, "failed to mark conversation read")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/moderation"
+)
+
+// chirpModeration is what createChirp needs out of a moderation verdict
+type chirpModeration struct {
+	body       string
+	rejected   []string
+	flaggedAt  sql.NullTime
+	flagReason sql.NullString
+}
+
+// checkChirpBody runs the checks every chirp body has to pass, new or edited:
+// the length limit and the moderation rules. The error is safe to show to the
+// client.
+func (cfg *apiConfig) checkChirpBody(body string) (chirpModeration, error) {
+	if length := chirptext.Length(body); length > cfg.maxChirpLength {
+		return chirpModeration{}, fmt.Errorf("chirp is too long (length: %d, max: %d)", length, cfg.maxChirpLength)
+	}
+
+	moderated := cfg.moderateChirp(body)
+	if len(moderated.rejected) > 0 {
+		return chirpModeration{}, fmt.Errorf("chirp rejected by moderation (rules: %s)", strings.Join(moderated.rejected, ", "))
+	}
+	return moderated, nil
+}
+
+func (cfg *apiConfig) moderateChirp(body string) chirpModeration {
+	verdict := cfg.moderation.Load().Check(body)
+
+	result := chirpModeration{
+		body:     verdict.Body,
+		rejected: verdict.RulesFor(moderation.ActionReject),
+	}
+	if verdict.Flagged {
+		result.flaggedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		result.flagReason = sql.NullString{
+			String: strings.Join(verdict.RulesFor(moderation.ActionFlag), ","),
+			Valid:  true,
+		}
+	}
+	return result
+}
+
+// reloadModeration re-reads the rules from disk and swaps them in. If the new
+// config doesn't load, the old rules stay in place.
+func (cfg *apiConfig) reloadModeration(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.authenticateAdmin(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	pipeline, err := moderation.Load(cfg.moderationConfig)
+	if err != nil {
+		fmt.Println("error reloading moderation rules: ", err)
+		respondWithError(w, 500, "could not load moderation rules")
+		return
+	}
+	cfg.moderation.Store(pipeline)
+
+	err = respondWithJSON(w, 200, map[string][]string{"rules": pipeline.Rules()})
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
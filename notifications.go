@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	notificationFollow  = "follow"
+	notificationMention = "mention"
+	notificationReply   = "reply"
+	notificationLike    = "like"
+	notificationRechirp = "rechirp"
+	// for protected accounts
+	notificationFollowRequest  = "follow_request"
+	notificationFollowAccepted = "follow_accepted"
+
+	// how many of the people in a group are listed, the rest are just counted
+	notificationMaxActors = 3
+)
+
+var notificationTypes = []string{
+	notificationFollow,
+	notificationMention,
+	notificationReply,
+	notificationLike,
+	notificationRechirp,
+	notificationFollowRequest,
+	notificationFollowAccepted,
+}
+
+type NotificationActor struct {
+	ID     uuid.UUID `json:"id"`
+	Handle string    `json:"handle"`
+}
+
+type Notification struct {
+	ID      uuid.UUID  `json:"id"`
+	Type    string     `json:"type"`
+	ChirpID *uuid.UUID `json:"chirp_id,omitempty"`
+	// e.g. "alice and 2 others liked your chirp"
+	Summary string `json:"summary"`
+	// the latest few, ActorCount is all of them
+	Actors     []NotificationActor `json:"actors"`
+	ActorCount int64               `json:"actor_count"`
+	Read       bool                `json:"read"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+type NotificationList struct {
+	UnreadCount   int64          `json:"unread_count"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// notification is something that happened to recipient because of actor
+type notification struct {
+	recipient uuid.UUID
+	actor     uuid.UUID
+	kind      string
+	chirpID   uuid.NullUUID
+}
+
+// groupKey decides what gets grouped: every follow (or follow request, or
+// accepted request) together, likes and rechirps per chirp. Mentions and
+// replies are each their own chirp so they never group.
+func (n notification) groupKey() string {
+	if !n.chirpID.Valid {
+		return n.kind
+	}
+	return n.kind + ":" + n.chirpID.UUID.String()
+}
+
+// notify records a notification, joining the recipient's unread one in the
+// same group if there is one. It's best effort: the action that caused it
+// has already happened, so errors are only logged.
+func (cfg *apiConfig) notify(ctx context.Context, n notification) {
+	if n.recipient == n.actor {
+		return
+	}
+	err := cfg.writeNotification(ctx, n)
+	if err != nil {
+		log.Printf("error writing %s notification: %v", n.kind, err)
+	}
+}
+
+func (cfg *apiConfig) writeNotification(ctx context.Context, n notification) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	notificationID, err := qtx.UpsertNotification(ctx, database.UpsertNotificationParams{
+		UserID:   n.recipient,
+		Type:     n.kind,
+		ChirpID:  n.chirpID,
+		GroupKey: n.groupKey(),
+		ActorID:  n.actor,
+	})
+	if err != nil {
+		// turned off, muted or blocked
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	err = qtx.AddNotificationActor(ctx, database.AddNotificationActorParams{
+		NotificationID: notificationID,
+		ActorID:        n.actor,
+	})
+	if err != nil {
+		return err
+	}
+	err = publishEvent(ctx, qtx, eventNotification, notificationEvent{
+		NotificationID: notificationID,
+		UserID:         n.recipient,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func notificationSummary(kind string, actors []NotificationActor, count int64) string {
+	who := "someone"
+	if len(actors) > 0 {
+		who = "@" + actors[0].Handle
+	}
+	switch {
+	case count == 2:
+		who += " and 1 other"
+	case count > 2:
+		who += fmt.Sprintf(" and %d others", count-1)
+	}
+
+	switch kind {
+	case notificationFollow:
+		return who + " followed you"
+	case notificationMention:
+		return who + " mentioned you"
+	case notificationReply:
+		return who + " replied to your chirp"
+	case notificationLike:
+		return who + " liked your chirp"
+	case notificationRechirp:
+		return who + " rechirped your chirp"
+	case notificationFollowRequest:
+		return who + " asked to follow you"
+	case notificationFollowAccepted:
+		return who + " accepted your follow request"
+	}
+	return who
+}
+
+// listNotifications returns the caller's notifications, most recent activity
+// first. ?unread=true leaves out the read ones.
+func (cfg *apiConfig) listNotifications(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	rows, err := cfg.dbQueries.ListNotifications(r.Context(), database.ListNotificationsParams{
+		UserID:     user.ID,
+		UnreadOnly: unreadOnly,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching notifications: ", err)
+		respondWithError(w, 500, "failed to fetch notifications")
+		return
+	}
+
+	unread, err := cfg.dbQueries.CountUnreadNotifications(r.Context(), user.ID)
+	if err != nil {
+		fmt.Println("error counting notifications: ", err)
+		respondWithError(w, 500, "failed to fetch notifications")
+		return
+	}
+
+	notifications, err := cfg.notificationsToJSON(r.Context(), rows)
+	if err != nil {
+		fmt.Println("error building notifications: ", err)
+		respondWithError(w, 500, "failed to fetch notifications")
+		return
+	}
+	respondWithJSON(w, 200, NotificationList{
+		UnreadCount:   unread,
+		Notifications: notifications,
+	})
+}
+
+func (cfg *apiConfig) notificationsToJSON(ctx context.Context, rows []database.Notification) ([]Notification, error) {
+	notifications := make([]Notification, 0, len(rows))
+	if len(rows) == 0 {
+		return notifications, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(rows))
+	for i := range rows {
+		ids = append(ids, rows[i].ID)
+	}
+	actorRows, err := cfg.dbQueries.GetNotificationActors(ctx, database.GetNotificationActorsParams{
+		NotificationIds: ids,
+		MaxActors:       notificationMaxActors,
+	})
+	if err != nil {
+		return nil, err
+	}
+	actors := make(map[uuid.UUID][]NotificationActor, len(rows))
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, a := range actorRows {
+		actors[a.NotificationID] = append(actors[a.NotificationID], NotificationActor{
+			ID:     a.ActorID,
+			Handle: a.Handle,
+		})
+		counts[a.NotificationID] = a.ActorCount
+	}
+
+	for i := range rows {
+		n := Notification{
+			ID:         rows[i].ID,
+			Type:       rows[i].Type,
+			ChirpID:    nullUUIDPtr(rows[i].ChirpID),
+			Actors:     actors[rows[i].ID],
+			ActorCount: counts[rows[i].ID],
+			Read:       rows[i].ReadAt.Valid,
+			CreatedAt:  rows[i].CreatedAt,
+			UpdatedAt:  rows[i].UpdatedAt,
+		}
+		if n.Actors == nil {
+			n.Actors = []NotificationActor{}
+		}
+		n.Summary = notificationSummary(n.Type, n.Actors, n.ActorCount)
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+func (cfg *apiConfig) getUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	unread, err := cfg.dbQueries.CountUnreadNotifications(r.Context(), user.ID)
+	if err != nil {
+		fmt.Println("error counting notifications: ", err)
+		respondWithError(w, 500, "failed to count notifications")
+		return
+	}
+	respondWithJSON(w, 200, map[string]int64{"unread_count": unread})
+}
+
+func (cfg *apiConfig) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	notificationID, err := uuid.Parse(r.PathValue("notificationID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid notification ID")
+		return
+	}
+
+	updated, err := cfg.dbQueries.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{
+		ID:     notificationID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		fmt.Println("error marking notification read: ", err)
+		respondWithError(w, 500, "failed to mark notification read")
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, 404, "no notification found with the requested ID")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	err = cfg.dbQueries.MarkAllNotificationsRead(r.Context(), user.ID)
+	if err != nil {
+		fmt.Println("error marking notifications read: ", err)
+		respondWithError(w, 500, "failed to mark notifications read")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notificationPreferences returns every type with whether it's on, types
+// without a stored preference are on
+func (cfg *apiConfig) notificationPreferences(ctx context.Context, userID uuid.UUID) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(notificationTypes))
+	for _, kind := range notificationTypes {
+		prefs[kind] = true
+	}
+	stored, err := cfg.dbQueries.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, pref := range stored {
+		prefs[pref.Type] = pref.Enabled
+	}
+	return prefs, nil
+}
+
+func (cfg *apiConfig) getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	prefs, err := cfg.notificationPreferences(r.Context(), user.ID)
+	if err != nil {
+		fmt.Println("error fetching notification preferences: ", err)
+		respondWithError(w, 500, "failed to fetch notification preferences")
+		return
+	}
+	respondWithJSON(w, 200, prefs)
+}
+
+// updateNotificationPreferences takes {"like": false, ...}, types left out
+// keep their current setting
+func (cfg *apiConfig) updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	update := map[string]bool{}
+	err = json.Unmarshal(data, &update)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+	for kind := range update {
+		if !slices.Contains(notificationTypes, kind) {
+			respondWithError(w, 400, fmt.Sprintf("unknown notification type %q", kind))
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to update notification preferences")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	for kind, enabled := range update {
+		err = qtx.SetNotificationPreference(r.Context(), database.SetNotificationPreferenceParams{
+			UserID:  user.ID,
+			Type:    kind,
+			Enabled: enabled,
+		})
+		if err != nil {
+			fmt.Println("error saving notification preference: ", err)
+			respondWithError(w, 500, "failed to update notification preferences")
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing notification preferences: ", err)
+		respondWithError(w, 500, "failed to update notification preferences")
+		return
+	}
+
+	prefs, err := cfg.notificationPreferences(r.Context(), user.ID)
+	if err != nil {
+		fmt.Println("error fetching notification preferences: ", err)
+		respondWithError(w, 500, "failed to fetch notification preferences")
+		return
+	}
+	respondWithJSON(w, 200, prefs)
+}
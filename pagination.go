@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination reads the limit and offset query params, falling back to
+// defaultPageSize and clamping to maxPageSize
+func parsePagination(r *http.Request) (limit int32, offset int32, err error) {
+	limit = defaultPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit: %q", raw)
+		}
+		limit = int32(min(n, maxPageSize))
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %q", raw)
+		}
+		offset = int32(n)
+	}
+	return limit, offset, nil
+}
+
+// keyset pagination: a cursor points at the last item of the previous page by
+// its (created_at, id) so the next page picks up right after it, no matter how
+// many rows were added in front in the meantime
+
+type cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// firstPageCursor sorts after everything, so "before it" is the whole table
+var firstPageCursor = cursor{
+	CreatedAt: time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC),
+	ID:        uuid.Max,
+}
+
+func (c cursor) String() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, fmt.Errorf("invalid cursor")
+	}
+	ts, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return cursor{}, fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return cursor{}, fmt.Errorf("invalid cursor")
+	}
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return cursor{}, fmt.Errorf("invalid cursor")
+	}
+	return cursor{CreatedAt: createdAt, ID: uid}, nil
+}
+
+// parseKeysetPagination reads the limit and cursor query params for keyset
+// paginated routes
+func parseKeysetPagination(r *http.Request) (limit int32, after cursor, err error) {
+	limit, _, err = parsePagination(r)
+	if err != nil {
+		return 0, cursor{}, err
+	}
+	after = firstPageCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		after, err = parseCursor(raw)
+		if err != nil {
+			return 0, cursor{}, err
+		}
+	}
+	return limit, after, nil
+}
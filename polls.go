@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// a chirp can be posted with a poll, two to four options and when it
+// closes. Everyone who can see the chirp gets one vote, the poll_votes
+// primary key makes sure of it. How the votes went is only shown to those
+// who voted, and to everyone once the poll is closed.
+//
+// Polls are closed by runScheduler, a little after their closes_at. Until
+// then a poll is open, whatever the time: reads and votes only look at
+// whether it's been closed.
+
+const (
+	minPollOptions = 2
+	maxPollOptions = 4
+	// in characters, counted like a chirp's body
+	maxPollOptionLength = 25
+	minPollDuration     = 5 * time.Minute
+	maxPollDuration     = 7 * 24 * time.Hour
+	// how many polls closePolls closes per query
+	pollCloseBatch = 100
+)
+
+// pollRequest is the poll asked for with a chirp. Scheduled chirps and
+// drafts keep it as JSON until they're published.
+type pollRequest struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+type Poll struct {
+	Options  []PollOption `json:"options"`
+	ClosesAt time.Time    `json:"closes_at"`
+	Closed   bool         `json:"closed"`
+	// the position of the option the viewer voted for
+	VotedFor *int32 `json:"voted_for,omitempty"`
+	// left out, like the options' votes, until the viewer has voted or the
+	// poll is closed
+	TotalVotes *int64 `json:"total_votes,omitempty"`
+}
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes *int64 `json:"votes,omitempty"`
+}
+
+// checkPoll checks a poll for a chirp going out at from and returns it as it
+// will be saved: options trimmed and run through the moderation rules, the
+// closing time in UTC. flagged is the rules that flagged any of the options.
+// The error is safe to show to the client.
+func (cfg *apiConfig) checkPoll(poll *pollRequest, from time.Time) (checked *pollRequest, flagged []string, err error) {
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return nil, nil, fmt.Errorf("a poll must have %d to %d options", minPollOptions, maxPollOptions)
+	}
+	err = checkPollCloses(poll.ClosesAt, from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checked = &pollRequest{
+		Options:  make([]string, 0, len(poll.Options)),
+		ClosesAt: poll.ClosesAt.UTC(),
+	}
+	for _, option := range poll.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return nil, nil, errors.New("poll options can't be empty")
+		}
+		if length := chirptext.Length(option); length > maxPollOptionLength {
+			return nil, nil, fmt.Errorf("poll option is too long (length: %d, max: %d)", length, maxPollOptionLength)
+		}
+		moderated := cfg.moderateChirp(option)
+		if len(moderated.rejected) > 0 {
+			return nil, nil, fmt.Errorf("poll option rejected by moderation (rules: %s)", strings.Join(moderated.rejected, ", "))
+		}
+		// as shown, two options can come out the same once masked
+		if slices.Contains(checked.Options, moderated.body) {
+			return nil, nil, fmt.Errorf("poll option %q is listed twice", moderated.body)
+		}
+		if moderated.flagReason.Valid {
+			for _, rule := range strings.Split(moderated.flagReason.String, ",") {
+				if !slices.Contains(flagged, rule) {
+					flagged = append(flagged, rule)
+				}
+			}
+		}
+		checked.Options = append(checked.Options, moderated.body)
+	}
+	return checked, flagged, nil
+}
+
+// checkPollCloses checks a poll's closing time for a chirp going out at from
+func checkPollCloses(closesAt, from time.Time) error {
+	duration := closesAt.Sub(from)
+	if duration < minPollDuration || duration > maxPollDuration {
+		return fmt.Errorf("a poll must close between %s and %s after the chirp is published", minPollDuration, maxPollDuration)
+	}
+	return nil
+}
+
+// pollJSON is how a poll is kept on a scheduled chirp or a draft, JSON
+// null for none
+func pollJSON(poll *pollRequest) (string, error) {
+	data, err := json.Marshal(poll)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parsePollJSON reads a poll kept by pollJSON
+func parsePollJSON(data json.RawMessage) (*pollRequest, error) {
+	var poll *pollRequest
+	err := json.Unmarshal(data, &poll)
+	if err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// savePoll saves a checked poll for a new chirp, in the transaction the
+// chirp is created in
+func savePoll(ctx context.Context, qtx *database.Queries, chirpID uuid.UUID, poll *pollRequest) error {
+	err := qtx.CreatePoll(ctx, database.CreatePollParams{
+		ChirpID:  chirpID,
+		ClosesAt: poll.ClosesAt,
+	})
+	if err != nil {
+		return err
+	}
+	for i, option := range poll.Options {
+		err = qtx.CreatePollOption(ctx, database.CreatePollOptionParams{
+			ChirpID:  chirpID,
+			Position: int32(i),
+			Text:     option,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pollOptionKey struct {
+	chirpID  uuid.UUID
+	position int32
+}
+
+// chirpPolls loads the polls of chirps as viewer gets to see them
+func (cfg *apiConfig) chirpPolls(ctx context.Context, viewer uuid.UUID, chirpIDs []uuid.UUID) (map[uuid.UUID]*Poll, error) {
+	pollRows, err := cfg.dbQueries.GetPolls(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	polls := make(map[uuid.UUID]*Poll, len(pollRows))
+	if len(pollRows) == 0 {
+		return polls, nil
+	}
+	pollIDs := make([]uuid.UUID, 0, len(pollRows))
+	for i := range pollRows {
+		pollIDs = append(pollIDs, pollRows[i].ChirpID)
+	}
+
+	optionRows, err := cfg.dbQueries.GetPollOptions(ctx, pollIDs)
+	if err != nil {
+		return nil, err
+	}
+	options := make(map[uuid.UUID][]database.PollOption, len(pollRows))
+	for _, o := range optionRows {
+		options[o.ChirpID] = append(options[o.ChirpID], o)
+	}
+
+	voteCounts, err := cfg.dbQueries.CountPollVotes(ctx, pollIDs)
+	if err != nil {
+		return nil, err
+	}
+	votes := make(map[pollOptionKey]int64, len(voteCounts))
+	for _, vc := range voteCounts {
+		votes[pollOptionKey{vc.ChirpID, vc.Position}] = vc.VoteCount
+	}
+
+	votedFor := map[uuid.UUID]int32{}
+	if viewer != uuid.Nil {
+		viewerVotes, err := cfg.dbQueries.GetPollVotes(ctx, database.GetPollVotesParams{
+			UserID:   viewer,
+			ChirpIds: pollIDs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range viewerVotes {
+			votedFor[v.ChirpID] = v.Position
+		}
+	}
+
+	for i := range pollRows {
+		chirpID := pollRows[i].ChirpID
+		poll := &Poll{
+			Options:  make([]PollOption, 0, len(options[chirpID])),
+			ClosesAt: pollRows[i].ClosesAt,
+			Closed:   pollRows[i].ClosedAt.Valid,
+		}
+		position, voted := votedFor[chirpID]
+		if voted {
+			poll.VotedFor = &position
+		}
+		showResults := voted || poll.Closed
+		var total int64
+		for _, o := range options[chirpID] {
+			option := PollOption{Text: o.Text}
+			if showResults {
+				count := votes[pollOptionKey{chirpID, o.Position}]
+				option.Votes = &count
+				total += count
+			}
+			poll.Options = append(poll.Options, option)
+		}
+		if showResults {
+			poll.TotalVotes = &total
+		}
+		polls[chirpID] = poll
+	}
+	return polls, nil
+}
+
+// voteInPoll votes in a chirp's poll for the caller. A vote can't be
+// changed or taken back.
+func (cfg *apiConfig) voteInPoll(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type voteReq struct {
+		// the option's position, from 0
+		Option *int32 `json:"option"`
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	reqData := voteReq{}
+	err = json.Unmarshal(data, &reqData)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+	if reqData.Option == nil {
+		respondWithError(w, 400, "option is required")
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to vote")
+		return
+	}
+	if cfg.respondIfHidden(w, r, user.ID, &chirp, "no chirp found with the requested ID") {
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithTombstone(w, &chirp)
+		return
+	}
+
+	polls, err := cfg.dbQueries.GetPolls(r.Context(), []uuid.UUID{chirp.ID})
+	if err != nil {
+		fmt.Println("error fetching poll: ", err)
+		respondWithError(w, 500, "failed to vote")
+		return
+	}
+	if len(polls) == 0 {
+		respondWithError(w, 404, "this chirp has no poll")
+		return
+	}
+	if polls[0].ClosedAt.Valid {
+		respondWithError(w, 409, "the poll is closed")
+		return
+	}
+	options, err := cfg.dbQueries.GetPollOptions(r.Context(), []uuid.UUID{chirp.ID})
+	if err != nil {
+		fmt.Println("error fetching poll options: ", err)
+		respondWithError(w, 500, "failed to vote")
+		return
+	}
+	if *reqData.Option < 0 || int(*reqData.Option) >= len(options) {
+		respondWithError(w, 400, "no such option in this poll")
+		return
+	}
+
+	voted, err := cfg.dbQueries.CreatePollVote(r.Context(), database.CreatePollVoteParams{
+		UserID:   user.ID,
+		Position: *reqData.Option,
+		ChirpID:  chirp.ID,
+	})
+	if err != nil {
+		fmt.Println("error saving vote: ", err)
+		respondWithError(w, 500, "failed to vote")
+		return
+	}
+	if voted == 0 {
+		// either they voted already, or the poll closed in the meantime
+		votes, err := cfg.dbQueries.GetPollVotes(r.Context(), database.GetPollVotesParams{
+			UserID:   user.ID,
+			ChirpIds: []uuid.UUID{chirp.ID},
+		})
+		if err != nil {
+			fmt.Println("error fetching vote: ", err)
+			respondWithError(w, 500, "failed to vote")
+			return
+		}
+		if len(votes) > 0 {
+			respondWithError(w, 409, "you already voted in this poll")
+			return
+		}
+		respondWithError(w, 409, "the poll is closed")
+		return
+	}
+
+	cfg.respondWithChirp(w, r, user.ID, 200, &chirp)
+}
+
+// closePolls closes every poll past its closes_at, it runs with the
+// scheduler
+func (cfg *apiConfig) closePolls(ctx context.Context) {
+	closed := 0
+	for {
+		ids, err := cfg.dbQueries.ClosePolls(ctx, pollCloseBatch)
+		if err != nil {
+			log.Printf("error closing polls: %v", err)
+			break
+		}
+		closed += len(ids)
+		if len(ids) < pollCloseBatch {
+			break
+		}
+	}
+	if closed > 0 {
+		log.Printf("closed %d polls", closed)
+	}
+}
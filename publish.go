@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// a chirp goes out the same way however it was posted, straight away,
+// from a draft or scheduled for later: postChirp is the whole of it for a
+// request, prepareChirp checks the chirp, insertChirp saves it with
+// everything that comes with it in the caller's transaction, and
+// chirpPublished tells everyone once that's committed.
+
+// chirpRequest is what's asked for when posting a chirp
+type chirpRequest struct {
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
+	// public unless set, see visibility.go
+	Visibility string `json:"visibility"`
+	// uploaded beforehand, see attachments.go
+	Attachments []attachmentRef `json:"attachments"`
+	// see polls.go
+	Poll *pollRequest `json:"poll"`
+}
+
+// chirpTxFunc runs in the transaction a chirp is saved or scheduled in,
+// for whatever has to happen with it or not at all (like deleting the draft
+// it came from). An error undoes the chirp, a *chirpError is answered like
+// prepareChirp's.
+type chirpTxFunc func(ctx context.Context, qtx *database.Queries) error
+
+// postChirp posts req for author and answers the request: the new chirp, or
+// the scheduled chirp when publishAt is set. inTx can be nil.
+func (cfg *apiConfig) postChirp(w http.ResponseWriter, r *http.Request, author uuid.UUID, req *chirpRequest, publishAt *time.Time, inTx chirpTxFunc) {
+	err := checkAttachmentRefs(req.Attachments)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	goesOut := time.Now()
+	if publishAt != nil {
+		err = checkPublishAt(*publishAt)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		goesOut = *publishAt
+	}
+
+	prepared, err := cfg.prepareChirp(r.Context(), author, req, goesOut)
+	if err != nil {
+		respondWithChirpError(w, err, "failed to create chirp")
+		return
+	}
+
+	if publishAt != nil {
+		cfg.scheduleChirp(w, r, author, req, *publishAt, inTx)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to create chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	newChirp, mentioned, err := cfg.insertChirp(r.Context(), qtx, &prepared)
+	if err != nil {
+		fmt.Println("error creating chirp: ", err)
+		respondWithError(w, 500, "failed to create chirp")
+		return
+	}
+	err = attachToChirp(r.Context(), qtx, author, newChirp.ID, req.Attachments)
+	if err != nil {
+		if errors.Is(err, errAttachmentUnavailable) {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		fmt.Println("error attaching uploads: ", err)
+		respondWithError(w, 500, "failed to create chirp")
+		return
+	}
+	if inTx != nil {
+		err = inTx(r.Context(), qtx)
+		if err != nil {
+			respondWithChirpError(w, err, "failed to create chirp")
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing chirp: ", err)
+		respondWithError(w, 500, "failed to create chirp")
+		return
+	}
+
+	cfg.chirpPublished(r.Context(), &newChirp, prepared.repliedTo, mentioned)
+	cfg.respondWithChirp(w, r, author, 201, &newChirp)
+}
+
+// chirpError is a chirp that can't be posted as asked, code is the HTTP
+// status to answer with
+type chirpError struct {
+	code int
+	msg  string
+}
+
+func (e *chirpError) Error() string {
+	return e.msg
+}
+
+// respondWithChirpError answers with a chirpError's status and message, any
+// other error is logged and answered with a 500 saying failed
+func respondWithChirpError(w http.ResponseWriter, err error, failed string) {
+	var chirpErr *chirpError
+	if errors.As(err, &chirpErr) {
+		respondWithError(w, chirpErr.code, chirpErr.msg)
+		return
+	}
+	fmt.Println("error creating chirp: ", err)
+	respondWithError(w, 500, failed)
+}
+
+// preparedChirp is a chirp that passed prepareChirp
+type preparedChirp struct {
+	params database.CreateChirpParams
+	// the author of the chirp being replied to, for the notification
+	repliedTo uuid.UUID
+	// as checkPoll returned it, nil for none
+	poll *pollRequest
+}
+
+// prepareChirp checks a chirp author wants to post at publishAt: its body,
+// its visibility, its poll and the chirps it replies to or quotes. Anything
+// wrong with it comes back as a *chirpError. The attachments are checked
+// separately, by checkAttachmentRefs.
+func (cfg *apiConfig) prepareChirp(ctx context.Context, author uuid.UUID, req *chirpRequest, publishAt time.Time) (preparedChirp, error) {
+	// check length and run the moderation rules
+	moderated, err := cfg.checkChirpBody(req.Body)
+	if err != nil {
+		return preparedChirp{}, &chirpError{400, err.Error()}
+	}
+
+	visibility, err := parseVisibility(req.Visibility)
+	if err != nil {
+		return preparedChirp{}, &chirpError{400, err.Error()}
+	}
+
+	prepared := preparedChirp{params: database.CreateChirpParams{
+		Body:       moderated.body,
+		UserID:     author,
+		FlaggedAt:  moderated.flaggedAt,
+		FlagReason: moderated.flagReason,
+		Visibility: visibility,
+	}}
+
+	if req.Poll != nil {
+		poll, flagged, err := cfg.checkPoll(req.Poll, publishAt)
+		if err != nil {
+			return preparedChirp{}, &chirpError{400, err.Error()}
+		}
+		prepared.poll = poll
+		// options the rules flag flag the whole chirp
+		var reasons []string
+		if moderated.flagReason.Valid {
+			reasons = strings.Split(moderated.flagReason.String, ",")
+		}
+		for _, rule := range flagged {
+			if !slices.Contains(reasons, rule) {
+				reasons = append(reasons, rule)
+			}
+		}
+		if len(reasons) > 0 {
+			if !prepared.params.FlaggedAt.Valid {
+				prepared.params.FlaggedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+			}
+			prepared.params.FlagReason = sql.NullString{String: strings.Join(reasons, ","), Valid: true}
+		}
+	}
+
+	if req.InReplyTo != nil {
+		parent, err := cfg.chirpTarget(ctx, author, *req.InReplyTo, "replied to", "reply to")
+		if err != nil {
+			return preparedChirp{}, err
+		}
+		prepared.params.InReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		prepared.repliedTo = parent.UserID
+		// a reply to a reply belongs to the same conversation as its parent
+		prepared.params.RootID = parent.RootID
+		if !prepared.params.RootID.Valid {
+			prepared.params.RootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	if req.QuoteOf != nil {
+		quoted, err := cfg.chirpTarget(ctx, author, *req.QuoteOf, "quoted", "quote")
+		if err != nil {
+			return preparedChirp{}, err
+		}
+		prepared.params.QuoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
+	return prepared, nil
+}
+
+// chirpTarget fetches a chirp being replied to or quoted, as long as author
+// can see it, it's not deleted and neither of them blocked the other. done
+// and do word the errors: "the chirp being <done> ...", "you can't <do>
+// this chirp".
+func (cfg *apiConfig) chirpTarget(ctx context.Context, author, id uuid.UUID, done, do string) (database.Chirp, error) {
+	target, err := cfg.dbQueries.GetChirpByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Chirp{}, &chirpError{404, fmt.Sprintf("the chirp being %s does not exist", done)}
+		}
+		return database.Chirp{}, fmt.Errorf("fetching the chirp being %s: %w", done, err)
+	}
+	visible, err := cfg.canViewChirp(ctx, author, &target)
+	if err != nil {
+		return database.Chirp{}, fmt.Errorf("checking chirp visibility: %w", err)
+	}
+	if !visible {
+		return database.Chirp{}, &chirpError{404, fmt.Sprintf("the chirp being %s does not exist", done)}
+	}
+	if target.DeletedAt.Valid {
+		return database.Chirp{}, &chirpError{410, fmt.Sprintf("the chirp being %s has been deleted", done)}
+	}
+	blocked, err := cfg.blockedBetween(ctx, author, target.UserID)
+	if err != nil {
+		return database.Chirp{}, fmt.Errorf("checking blocks: %w", err)
+	}
+	if blocked {
+		return database.Chirp{}, &chirpError{403, fmt.Sprintf("you can't %s this chirp", do)}
+	}
+	return target, nil
+}
+
+// insertChirp saves a prepared chirp in qtx's transaction, with its poll,
+// hashtags, mentions, fan-out job and stream event, so none of them can exist
+// without the others. It returns who the chirp mentions.
+func (cfg *apiConfig) insertChirp(ctx context.Context, qtx *database.Queries, prepared *preparedChirp) (database.Chirp, []uuid.UUID, error) {
+	newChirp, err := qtx.CreateChirp(ctx, prepared.params)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	}
+	if prepared.poll != nil {
+		err = savePoll(ctx, qtx, newChirp.ID, prepared.poll)
+		if err != nil {
+			return database.Chirp{}, nil, fmt.Errorf("saving poll: %w", err)
+		}
+	}
+	err = saveHashtags(ctx, qtx, &newChirp)
+	if err != nil {
+		return database.Chirp{}, nil, fmt.Errorf("saving hashtags: %w", err)
+	}
+	mentioned, err := saveMentions(ctx, qtx, &newChirp)
+	if err != nil {
+		return database.Chirp{}, nil, fmt.Errorf("saving mentions: %w", err)
+	}
+	err = qtx.EnqueueFanout(ctx, newChirp.ID)
+	if err != nil {
+		return database.Chirp{}, nil, fmt.Errorf("queueing fan-out: %w", err)
+	}
+	err = publishEvent(ctx, qtx, eventChirpCreated, chirpEvent{
+		ChirpID: newChirp.ID,
+		UserID:  newChirp.UserID,
+		RootID:  conversationRoot(&newChirp),
+	})
+	if err != nil {
+		return database.Chirp{}, nil, fmt.Errorf("publishing chirp event: %w", err)
+	}
+	return newChirp, mentioned, nil
+}
+
+// chirpPublished does what's left once a new chirp is committed: waking the
+// fan-out, notifying who it replies to and mentions, and reporting it if the
+// moderation rules flagged it
+func (cfg *apiConfig) chirpPublished(ctx context.Context, newChirp *database.Chirp, repliedTo uuid.UUID, mentioned []uuid.UUID) {
+	cfg.wakeFanout()
+
+	chirpRef := uuid.NullUUID{UUID: newChirp.ID, Valid: true}
+	if repliedTo != uuid.Nil {
+		// no point telling them about a reply they can't open
+		visible, err := cfg.canViewChirp(ctx, repliedTo, newChirp)
+		if err != nil {
+			fmt.Println("error checking chirp visibility: ", err)
+		}
+		if !visible {
+			repliedTo = uuid.Nil
+		}
+	}
+	if repliedTo != uuid.Nil {
+		cfg.notify(ctx, notification{
+			recipient: repliedTo,
+			actor:     newChirp.UserID,
+			kind:      notificationReply,
+			chirpID:   chirpRef,
+		})
+	}
+	// replying already told them
+	cfg.notifyMentioned(ctx, newChirp, mentioned, repliedTo)
+
+	if newChirp.FlaggedAt.Valid {
+		cfg.fileModerationReport(ctx, newChirp)
+	}
+}
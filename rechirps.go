@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// rechirp reshares a chirp on the caller's listing. Doing it twice is a no-op.
+// Only public and unlisted chirps from accounts that aren't protected can be
+// rechirped, the others are meant for a narrower audience than the
+// rechirper's.
+func (cfg *apiConfig) rechirp(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to rechirp")
+		return
+	}
+	if cfg.respondIfHidden(w, r, user.ID, &chirp, "no chirp found with the requested ID") {
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithTombstone(w, &chirp)
+		return
+	}
+	if chirp.Visibility != visibilityPublic && chirp.Visibility != visibilityUnlisted {
+		respondWithError(w, 403, "only public and unlisted chirps can be rechirped")
+		return
+	}
+	author, err := cfg.dbQueries.GetUserByID(r.Context(), chirp.UserID)
+	if err != nil {
+		fmt.Println("error fetching chirp author: ", err)
+		respondWithError(w, 500, "failed to rechirp")
+		return
+	}
+	if author.Protected {
+		respondWithError(w, 403, "chirps from protected accounts can't be rechirped")
+		return
+	}
+
+	created, err := cfg.dbQueries.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:  user.ID,
+		ChirpID: chirp.ID,
+	})
+	if err != nil {
+		fmt.Println("error creating rechirp: ", err)
+		respondWithError(w, 500, "failed to rechirp")
+		return
+	}
+	if created > 0 {
+		cfg.notify(r.Context(), notification{
+			recipient: chirp.UserID,
+			actor:     user.ID,
+			kind:      notificationRechirp,
+			chirpID:   uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		})
+	}
+
+	cfg.respondWithChirp(w, r, user.ID, 200, &chirp)
+}
+
+func (cfg *apiConfig) unrechirp(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	err = cfg.dbQueries.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:  user.ID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		fmt.Println("error deleting rechirp: ", err)
+		respondWithError(w, 500, "failed to undo rechirp")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getUserChirps lists a user's chirps together with what they rechirped,
+// newest first. Rechirps carry rechirped_by/rechirped_at for attribution.
+func (cfg *apiConfig) getUserChirps(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid user ID")
+		return
+	}
+	if cfg.respondIfBlocked(w, r, viewer, userID, "no user found with the requested ID") {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetUserChirps(r.Context(), database.GetUserChirpsParams{
+		UserID:   userID,
+		ViewerID: viewer,
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching user chirps: ", err)
+		respondWithError(w, 500, "failed to fetch chirps")
+		return
+	}
+
+	dbChirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		dbChirps = append(dbChirps, row.Chirp)
+	}
+
+	jsonChirps, err := cfg.chirpsToJSON(r.Context(), viewer, dbChirps)
+	if err != nil {
+		fmt.Println("error building chirps response: ", err)
+		respondWithError(w, 500, "failed to fetch chirps")
+		return
+	}
+	for i, row := range rows {
+		if row.RechirpedBy.Valid {
+			jsonChirps[i].RechirpedBy = &rows[i].RechirpedBy.UUID
+			jsonChirps[i].RechirpedAt = &rows[i].ActivityAt
+		}
+	}
+
+	respondWithJSON(w, 200, jsonChirps)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const maxReportReasonLength = 500
+
+// report statuses and resolutions, these match the CHECK constraints on the
+// reports table
+const (
+	reportStatusOpen     = "open"
+	reportStatusClaimed  = "claimed"
+	reportStatusResolved = "resolved"
+
+	resolutionDismiss       = "dismiss"
+	resolutionDeleteChirp   = "delete_chirp"
+	resolutionSuspendAuthor = "suspend_author"
+)
+
+type Report struct {
+	ID         uuid.UUID        `json:"id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	ChirpID    *uuid.UUID       `json:"chirp_id"`
+	ReporterID *uuid.UUID       `json:"reporter_id"`
+	Reason     string           `json:"reason"`
+	Status     string           `json:"status"`
+	ClaimedBy  *uuid.UUID       `json:"claimed_by,omitempty"`
+	ClaimedAt  *time.Time       `json:"claimed_at,omitempty"`
+	Resolution string           `json:"resolution,omitempty"`
+	ResolvedBy *uuid.UUID       `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time       `json:"resolved_at,omitempty"`
+	Decisions  []ReportDecision `json:"decisions,omitempty"`
+}
+
+type ReportDecision struct {
+	ModeratorID *uuid.UUID `json:"moderator_id"`
+	Action      string     `json:"action"`
+	Note        string     `json:"note,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func dbReportToJSONReport(rep *database.Report) Report {
+	return Report{
+		ID:         rep.ID,
+		CreatedAt:  rep.CreatedAt,
+		UpdatedAt:  rep.UpdatedAt,
+		ChirpID:    nullUUIDPtr(rep.ChirpID),
+		ReporterID: nullUUIDPtr(rep.ReporterID),
+		Reason:     rep.Reason,
+		Status:     rep.Status,
+		ClaimedBy:  nullUUIDPtr(rep.ClaimedBy),
+		ClaimedAt:  nullTimePtr(rep.ClaimedAt),
+		Resolution: rep.Resolution.String,
+		ResolvedBy: nullUUIDPtr(rep.ResolvedBy),
+		ResolvedAt: nullTimePtr(rep.ResolvedAt),
+	}
+}
+
+func (cfg *apiConfig) createReport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reportReq struct {
+		Reason string `json:"reason"`
+	}
+
+	reporter, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+	reportData := reportReq{}
+	err = json.Unmarshal(data, &reportData)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+
+	reason := strings.TrimSpace(reportData.Reason)
+	if reason == "" {
+		respondWithError(w, 400, "a reason is required")
+		return
+	}
+	if length := chirptext.Length(reason); length > maxReportReasonLength {
+		msg := fmt.Sprintf("reason is too long (length: %d, max: %d)", length, maxReportReasonLength)
+		respondWithError(w, 400, msg)
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to fetch chirp")
+		return
+	}
+	// a block doesn't stop a report, but visibility does: there's nothing
+	// to report in a chirp the reporter can't see
+	visible, err := cfg.canViewChirp(r.Context(), reporter.ID, &chirp)
+	if err != nil {
+		fmt.Println("error checking chirp visibility: ", err)
+		respondWithError(w, 500, "failed to fetch chirp")
+		return
+	}
+	if !visible {
+		respondWithError(w, 404, "no chirp found with the requested ID")
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithTombstone(w, &chirp)
+		return
+	}
+
+	report, err := cfg.dbQueries.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    uuid.NullUUID{UUID: chirpID, Valid: true},
+		ReporterID: uuid.NullUUID{UUID: reporter.ID, Valid: true},
+		Reason:     reason,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, 409, "you already have an open report on this chirp")
+			return
+		}
+		fmt.Println("error creating report: ", err)
+		respondWithError(w, 500, "failed to create report")
+		return
+	}
+
+	err = respondWithJSON(w, 201, dbReportToJSONReport(&report))
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
+
+// fileModerationReport puts a chirp the moderation pipeline flagged into the
+// review queue. There's no reporter, the reason lists the rules that matched.
+// A chirp already waiting for review isn't filed again, however many times
+// it's edited.
+func (cfg *apiConfig) fileModerationReport(ctx context.Context, chirp *database.Chirp) {
+	err := cfg.dbQueries.CreateModerationReport(ctx, database.CreateModerationReportParams{
+		ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Reason:  "flagged by moderation rules: " + chirp.FlagReason.String,
+	})
+	if err != nil {
+		fmt.Println("error filing moderation report: ", err)
+	}
+}
+
+func (cfg *apiConfig) listReports(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.authenticateAdmin(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reportStatusOpen
+	}
+	if status != reportStatusOpen && status != reportStatusClaimed && status != reportStatusResolved {
+		respondWithError(w, 400, "status must be one of open, claimed, resolved")
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	dbReports, err := cfg.dbQueries.ListReports(r.Context(), database.ListReportsParams{
+		Status: status,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		fmt.Println("error listing reports: ", err)
+		respondWithError(w, 500, "failed to fetch reports")
+		return
+	}
+
+	jsonReports := []Report{}
+	for _, dbReport := range dbReports {
+		jsonReports = append(jsonReports, dbReportToJSONReport(&dbReport))
+	}
+	respondWithJSON(w, 200, jsonReports)
+}
+
+func (cfg *apiConfig) getReport(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.authenticateAdmin(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid report ID")
+		return
+	}
+
+	report, err := cfg.dbQueries.GetReport(r.Context(), reportID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no report found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching report: ", err)
+		respondWithError(w, 500, "failed to fetch report")
+		return
+	}
+
+	resp, err := cfg.reportWithDecisions(r, &report)
+	if err != nil {
+		fmt.Println("error fetching report decisions: ", err)
+		respondWithError(w, 500, "failed to fetch report")
+		return
+	}
+	respondWithJSON(w, 200, resp)
+}
+
+func (cfg *apiConfig) reportWithDecisions(r *http.Request, report *database.Report) (Report, error) {
+	resp := dbReportToJSONReport(report)
+	decisions, err := cfg.dbQueries.ListReportDecisions(r.Context(), report.ID)
+	if err != nil {
+		return Report{}, err
+	}
+	for _, d := range decisions {
+		resp.Decisions = append(resp.Decisions, ReportDecision{
+			ModeratorID: nullUUIDPtr(d.ModeratorID),
+			Action:      d.Action,
+			Note:        d.Note,
+			CreatedAt:   d.CreatedAt,
+		})
+	}
+	return resp, nil
+}
+
+func (cfg *apiConfig) claimReport(w http.ResponseWriter, r *http.Request) {
+	moderator, err := cfg.authenticateAdmin(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid report ID")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to claim report")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	moderatorID := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+	report, err := qtx.ClaimReport(r.Context(), database.ClaimReportParams{
+		ID:        reportID,
+		ClaimedBy: moderatorID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.respondReportNotActionable(w, r, reportID, "report is not open")
+			return
+		}
+		fmt.Println("error claiming report: ", err)
+		respondWithError(w, 500, "failed to claim report")
+		return
+	}
+
+	err = qtx.CreateReportDecision(r.Context(), database.CreateReportDecisionParams{
+		ReportID:    report.ID,
+		ModeratorID: moderatorID,
+		Action:      "claim",
+	})
+	if err != nil {
+		fmt.Println("error recording report decision: ", err)
+		respondWithError(w, 500, "failed to claim report")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing report claim: ", err)
+		respondWithError(w, 500, "failed to claim report")
+		return
+	}
+
+	respondWithJSON(w, 200, dbReportToJSONReport(&report))
+}
+
+func (cfg *apiConfig) resolveReport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type resolveReq struct {
+		Resolution string `json:"resolution"`
+		Note       string `json:"note"`
+	}
+
+	moderator, err := cfg.authenticateAdmin(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid report ID")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+	resolveData := resolveReq{}
+	err = json.Unmarshal(data, &resolveData)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+
+	switch resolveData.Resolution {
+	case resolutionDismiss, resolutionDeleteChirp, resolutionSuspendAuthor:
+	default:
+		respondWithError(w, 400, "resolution must be one of dismiss, delete_chirp, suspend_author")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to resolve report")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	moderatorID := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+	report, err := qtx.ResolveReport(r.Context(), database.ResolveReportParams{
+		ID:         reportID,
+		Resolution: sql.NullString{String: resolveData.Resolution, Valid: true},
+		ResolvedBy: moderatorID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.respondReportNotActionable(w, r, reportID, "report must be claimed by you before resolving it")
+			return
+		}
+		fmt.Println("error resolving report: ", err)
+		respondWithError(w, 500, "failed to resolve report")
+		return
+	}
+
+	if resolveData.Resolution != resolutionDismiss {
+		if !report.ChirpID.Valid {
+			respondWithError(w, 409, "the reported chirp no longer exists")
+			return
+		}
+		chirp, err := qtx.GetChirpByID(r.Context(), report.ChirpID.UUID)
+		if err != nil {
+			fmt.Println("error fetching reported chirp: ", err)
+			respondWithError(w, 500, "failed to resolve report")
+			return
+		}
+
+		switch resolveData.Resolution {
+		case resolutionDeleteChirp:
+			err = qtx.DeleteChirp(r.Context(), chirp.ID)
+			if err == nil {
+				err = publishEvent(r.Context(), qtx, eventChirpDeleted, chirpEvent{
+					ChirpID:    chirp.ID,
+					UserID:     chirp.UserID,
+					RootID:     conversationRoot(&chirp),
+					Visibility: chirp.Visibility,
+				})
+			}
+		case resolutionSuspendAuthor:
+			err = qtx.SuspendUser(r.Context(), chirp.UserID)
+			if err == nil {
+				err = qtx.RevokeUserRefreshTokens(r.Context(), chirp.UserID)
+			}
+		}
+		if err != nil {
+			fmt.Println("error applying report resolution: ", err)
+			respondWithError(w, 500, "failed to resolve report")
+			return
+		}
+	}
+
+	err = qtx.CreateReportDecision(r.Context(), database.CreateReportDecisionParams{
+		ReportID:    report.ID,
+		ModeratorID: moderatorID,
+		Action:      resolveData.Resolution,
+		Note:        resolveData.Note,
+	})
+	if err != nil {
+		fmt.Println("error recording report decision: ", err)
+		respondWithError(w, 500, "failed to resolve report")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing report resolution: ", err)
+		respondWithError(w, 500, "failed to resolve report")
+		return
+	}
+
+	resp, err := cfg.reportWithDecisions(r, &report)
+	if err != nil {
+		resp = dbReportToJSONReport(&report)
+	}
+	respondWithJSON(w, 200, resp)
+}
+
+// respondReportNotActionable is for when a claim/resolve update matched no
+// rows, which is either a missing report (404) or one in the wrong state (409)
+func (cfg *apiConfig) respondReportNotActionable(w http.ResponseWriter, r *http.Request, reportID uuid.UUID, msg string) {
+	_, err := cfg.dbQueries.GetReport(r.Context(), reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "no report found with the requested ID")
+		return
+	}
+	respondWithError(w, 409, msg)
+}
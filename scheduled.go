@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// posting a chirp with a publish_at in the future schedules it instead. It's
+// checked then, so obvious mistakes show up right away, and again when it's
+// published: the rules may have changed, or the chirp it replies to been
+// deleted. A scheduled chirp that fails that second check stays around with
+// the reason, for its author to reschedule or cancel.
+//
+// runScheduler publishes them. Any number of instances can run it, each
+// scheduled chirp is claimed with FOR UPDATE SKIP LOCKED and deleted in the
+// transaction that creates the chirp, so it goes out exactly once.
+
+// how often the scheduler looks for due chirps, and so about how late one
+// can go out
+const schedulerPollInterval = 10 * time.Second
+
+// the failed_reason of a scheduled chirp that failed for reasons of our own
+const scheduledPublishFailed = "something went wrong publishing it, reschedule it to try again"
+
+type ScheduledChirp struct {
+	ID           uuid.UUID    `json:"id"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	PublishAt    time.Time    `json:"publish_at"`
+	Body         string       `json:"body"`
+	Visibility   string       `json:"visibility"`
+	InReplyTo    *uuid.UUID   `json:"in_reply_to,omitempty"`
+	QuoteOf      *uuid.UUID   `json:"quote_of,omitempty"`
+	Attachments  []Attachment `json:"attachments,omitempty"`
+	Poll         *pollRequest `json:"poll,omitempty"`
+	FailedReason string       `json:"failed_reason,omitempty"`
+}
+
+func dbScheduledChirpToJSON(s *database.ScheduledChirp) (ScheduledChirp, error) {
+	poll, err := parsePollJSON(s.Poll)
+	if err != nil {
+		return ScheduledChirp{}, err
+	}
+	return ScheduledChirp{
+		ID:           s.ID,
+		CreatedAt:    s.CreatedAt,
+		UpdatedAt:    s.UpdatedAt,
+		PublishAt:    s.PublishAt,
+		Body:         s.Body,
+		Visibility:   s.Visibility,
+		InReplyTo:    nullUUIDPtr(s.InReplyTo),
+		QuoteOf:      nullUUIDPtr(s.QuoteOf),
+		Poll:         poll,
+		FailedReason: s.FailedReason.String,
+	}, nil
+}
+
+// checkPublishAt makes sure a chirp is scheduled for later
+func checkPublishAt(publishAt time.Time) error {
+	if !publishAt.After(time.Now()) {
+		return errors.New("publish_at must be in the future")
+	}
+	return nil
+}
+
+// scheduleChirp is postChirp for a chirp with a publish_at, req has been
+// through prepareChirp and checkAttachmentRefs and publishAt through
+// checkPublishAt
+func (cfg *apiConfig) scheduleChirp(w http.ResponseWriter, r *http.Request, author uuid.UUID, req *chirpRequest, publishAt time.Time, inTx chirpTxFunc) {
+	visibility, err := parseVisibility(req.Visibility)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	poll, err := pollJSON(req.Poll)
+	if err != nil {
+		fmt.Println("error encoding poll: ", err)
+		respondWithError(w, 500, "failed to schedule chirp")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to schedule chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// the body and poll as written, moderation runs again when it's
+	// published
+	scheduled, err := qtx.CreateScheduledChirp(r.Context(), database.CreateScheduledChirpParams{
+		UserID:     author,
+		PublishAt:  publishAt.UTC(),
+		Body:       req.Body,
+		Visibility: visibility,
+		InReplyTo:  uuidPtrToNull(req.InReplyTo),
+		QuoteOf:    uuidPtrToNull(req.QuoteOf),
+		Poll:       poll,
+	})
+	if err != nil {
+		fmt.Println("error scheduling chirp: ", err)
+		respondWithError(w, 500, "failed to schedule chirp")
+		return
+	}
+	for i, ref := range req.Attachments {
+		attached, err := qtx.AttachToScheduledChirp(r.Context(), database.AttachToScheduledChirpParams{
+			ScheduledChirpID: uuid.NullUUID{UUID: scheduled.ID, Valid: true},
+			Position:         sql.NullInt32{Int32: int32(i), Valid: true},
+			AltText:          ref.AltText,
+			ID:               ref.ID,
+			UserID:           author,
+		})
+		if err != nil {
+			fmt.Println("error attaching uploads: ", err)
+			respondWithError(w, 500, "failed to schedule chirp")
+			return
+		}
+		if attached == 0 {
+			respondWithError(w, 400, fmt.Sprintf("%s: %s", errAttachmentUnavailable, ref.ID))
+			return
+		}
+	}
+	if inTx != nil {
+		err = inTx(r.Context(), qtx)
+		if err != nil {
+			respondWithChirpError(w, err, "failed to schedule chirp")
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing scheduled chirp: ", err)
+		respondWithError(w, 500, "failed to schedule chirp")
+		return
+	}
+
+	cfg.respondWithScheduledChirps(w, r, 201, []database.ScheduledChirp{scheduled}, true)
+}
+
+// respondWithScheduledChirps sends scheduled chirps with their attachments,
+// the first one alone if single is set
+func (cfg *apiConfig) respondWithScheduledChirps(w http.ResponseWriter, r *http.Request, code int, rows []database.ScheduledChirp, single bool) {
+	ids := make([]uuid.UUID, 0, len(rows))
+	for i := range rows {
+		ids = append(ids, rows[i].ID)
+	}
+	attachmentRows, err := cfg.dbQueries.GetScheduledChirpAttachments(r.Context(), ids)
+	if err != nil {
+		fmt.Println("error fetching scheduled chirp attachments: ", err)
+		respondWithError(w, 500, "failed to fetch scheduled chirps")
+		return
+	}
+	attachments := make(map[uuid.UUID][]Attachment, len(attachmentRows))
+	for i := range attachmentRows {
+		id := attachmentRows[i].ScheduledChirpID.UUID
+		attachments[id] = append(attachments[id], dbAttachmentToJSON(&attachmentRows[i]))
+	}
+
+	resp := make([]ScheduledChirp, 0, len(rows))
+	for i := range rows {
+		scheduled, err := dbScheduledChirpToJSON(&rows[i])
+		if err != nil {
+			fmt.Println("error reading scheduled chirp poll: ", err)
+			respondWithError(w, 500, "failed to fetch scheduled chirps")
+			return
+		}
+		scheduled.Attachments = attachments[scheduled.ID]
+		resp = append(resp, scheduled)
+	}
+	if single {
+		respondWithJSON(w, code, resp[0])
+		return
+	}
+	respondWithJSON(w, code, resp)
+}
+
+// listScheduledChirps lists the caller's scheduled chirps, the next one to
+// go out first
+func (cfg *apiConfig) listScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetScheduledChirps(r.Context(), database.GetScheduledChirpsParams{
+		UserID: user.ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		fmt.Println("error fetching scheduled chirps: ", err)
+		respondWithError(w, 500, "failed to fetch scheduled chirps")
+		return
+	}
+	cfg.respondWithScheduledChirps(w, r, 200, rows, false)
+}
+
+// rescheduleChirp moves a scheduled chirp to a new publish_at, a chirp that
+// failed to publish is tried again then. Its poll still has to close in the
+// allowed window after the new time.
+func (cfg *apiConfig) rescheduleChirp(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type rescheduleReq struct {
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "could not read request")
+		return
+	}
+
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid scheduled chirp ID")
+		return
+	}
+
+	reqData := rescheduleReq{}
+	err = json.Unmarshal(data, &reqData)
+	if err != nil {
+		respondWithError(w, 400, "could not unmarshal data")
+		return
+	}
+	if reqData.PublishAt == nil {
+		respondWithError(w, 400, "publish_at is required")
+		return
+	}
+	err = checkPublishAt(*reqData.PublishAt)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, "failed to reschedule chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// waits if the scheduler is publishing it right now, and then finds
+	// nothing
+	scheduled, err := qtx.RescheduleChirp(r.Context(), database.RescheduleChirpParams{
+		PublishAt: reqData.PublishAt.UTC(),
+		ID:        scheduledID,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no scheduled chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error rescheduling chirp: ", err)
+		respondWithError(w, 500, "failed to reschedule chirp")
+		return
+	}
+	// the poll can't be changed, so it has to still fit the new time or the
+	// chirp would never publish
+	poll, err := parsePollJSON(scheduled.Poll)
+	if err != nil {
+		fmt.Println("error reading scheduled chirp poll: ", err)
+		respondWithError(w, 500, "failed to reschedule chirp")
+		return
+	}
+	if poll != nil {
+		err = checkPollCloses(poll.ClosesAt, scheduled.PublishAt)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println("error committing reschedule: ", err)
+		respondWithError(w, 500, "failed to reschedule chirp")
+		return
+	}
+	cfg.respondWithScheduledChirps(w, r, 200, []database.ScheduledChirp{scheduled}, true)
+}
+
+// cancelScheduledChirp deletes a scheduled chirp before it goes out. Its
+// attachments are left for the purger.
+func (cfg *apiConfig) cancelScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid scheduled chirp ID")
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeleteScheduledChirp(r.Context(), database.DeleteScheduledChirpParams{
+		ID:     scheduledID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		fmt.Println("error cancelling scheduled chirp: ", err)
+		respondWithError(w, 500, "failed to cancel scheduled chirp")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "no scheduled chirp found with the requested ID")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runScheduler publishes scheduled chirps as they come due and closes polls
+// past their closing time, every schedulerPollInterval until ctx is done
+func (cfg *apiConfig) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			done, err := cfg.publishNextScheduled(ctx)
+			if err != nil {
+				log.Printf("error publishing scheduled chirp: %v", err)
+				break
+			}
+			if done {
+				break
+			}
+		}
+		cfg.closePolls(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishNextScheduled claims one due chirp and publishes it, done is true
+// when none are left. If it can't be published the reason is saved on it
+// instead, so the next due chirp can go.
+func (cfg *apiConfig) publishNextScheduled(ctx context.Context) (done bool, err error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	scheduled, err := qtx.ClaimDueScheduledChirp(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	err = cfg.publishScheduled(ctx, tx, qtx, &scheduled)
+	if err == nil {
+		return false, nil
+	}
+	var chirpErr *chirpError
+	if errors.As(err, &chirpErr) {
+		err = qtx.FailScheduledChirp(ctx, database.FailScheduledChirpParams{
+			FailedReason: sql.NullString{String: chirpErr.msg, Valid: true},
+			ID:           scheduled.ID,
+		})
+		if err != nil {
+			return false, fmt.Errorf("scheduled chirp %s: %w", scheduled.ID, err)
+		}
+		return false, tx.Commit()
+	}
+
+	// left as it is, it would be claimed first again on every run and hold
+	// up every chirp due after it, so it's failed too. That's a separate
+	// statement after the rollback, which undoes whatever publishing it got
+	// through.
+	log.Printf("error publishing scheduled chirp %s: %v", scheduled.ID, err)
+	tx.Rollback()
+	err = cfg.dbQueries.FailScheduledChirp(ctx, database.FailScheduledChirpParams{
+		FailedReason: sql.NullString{String: scheduledPublishFailed, Valid: true},
+		ID:           scheduled.ID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("scheduled chirp %s: %w", scheduled.ID, err)
+	}
+	return false, nil
+}
+
+// publishScheduled publishes a claimed scheduled chirp in tx, committing it.
+// A *chirpError is why it can't be published, and nothing's been done then.
+func (cfg *apiConfig) publishScheduled(ctx context.Context, tx *sql.Tx, qtx *database.Queries, scheduled *database.ScheduledChirp) error {
+	prepared, err := cfg.prepareScheduled(ctx, scheduled)
+	if err != nil {
+		return err
+	}
+
+	newChirp, mentioned, err := cfg.insertChirp(ctx, qtx, &prepared)
+	if err != nil {
+		return err
+	}
+	err = qtx.MoveScheduledAttachments(ctx, database.MoveScheduledAttachmentsParams{
+		ChirpID:          uuid.NullUUID{UUID: newChirp.ID, Valid: true},
+		ScheduledChirpID: uuid.NullUUID{UUID: scheduled.ID, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("moving attachments: %w", err)
+	}
+	_, err = qtx.DeleteScheduledChirp(ctx, database.DeleteScheduledChirpParams{
+		ID:     scheduled.ID,
+		UserID: scheduled.UserID,
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	cfg.chirpPublished(ctx, &newChirp, prepared.repliedTo, mentioned)
+	return nil
+}
+
+// prepareScheduled is prepareChirp for a chirp whose time has come, its
+// author may have been suspended since it was scheduled
+func (cfg *apiConfig) prepareScheduled(ctx context.Context, scheduled *database.ScheduledChirp) (preparedChirp, error) {
+	author, err := cfg.dbQueries.GetUserByID(ctx, scheduled.UserID)
+	if err != nil {
+		return preparedChirp{}, err
+	}
+	if author.SuspendedAt.Valid {
+		return preparedChirp{}, &chirpError{403, errAccountSuspended.Error()}
+	}
+	poll, err := parsePollJSON(scheduled.Poll)
+	if err != nil {
+		return preparedChirp{}, fmt.Errorf("reading poll: %w", err)
+	}
+	return cfg.prepareChirp(ctx, author.ID, &chirpRequest{
+		Body:       scheduled.Body,
+		InReplyTo:  nullUUIDPtr(scheduled.InReplyTo),
+		QuoteOf:    nullUUIDPtr(scheduled.QuoteOf),
+		Visibility: scheduled.Visibility,
+		Poll:       poll,
+	}, time.Now())
+}
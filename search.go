@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+	"github.com/whatsmynameagain/go-chirpy/internal/search"
+
+	"github.com/google/uuid"
+)
+
+const (
+	searchTypeChirps = "chirps"
+	searchTypeUsers  = "users"
+
+	searchSortRelevance = "relevance"
+	searchSortRecent    = "recent"
+)
+
+// likeEscaper makes user text safe to put inside a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchResults has both lists unless ?type= asked for just one, the other
+// is then empty
+type SearchResults struct {
+	Chirps []Chirp       `json:"chirps"`
+	Users  []UserSummary `json:"users"`
+}
+
+// searchHandler is GET /api/search?q=. Chirps are matched on their words
+// (see search.Parse for the syntax), users on their handle. ?type=chirps or
+// users searches only one of them, ?sort=recent orders chirps newest first
+// instead of best match first. limit/offset paginate each list.
+func (cfg *apiConfig) searchHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	params := r.URL.Query()
+	raw := params.Get("q")
+	if strings.TrimSpace(raw) == "" {
+		respondWithError(w, 400, "q is required")
+		return
+	}
+	query, err := search.Parse(raw)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	kind := params.Get("type")
+	if kind != "" && kind != searchTypeChirps && kind != searchTypeUsers {
+		respondWithError(w, 400, fmt.Sprintf("type must be %s or %s", searchTypeChirps, searchTypeUsers))
+		return
+	}
+	sort := params.Get("sort")
+	if sort == "" {
+		sort = searchSortRelevance
+	}
+	if sort != searchSortRelevance && sort != searchSortRecent {
+		respondWithError(w, 400, fmt.Sprintf("sort must be %s or %s", searchSortRelevance, searchSortRecent))
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	results := SearchResults{Chirps: []Chirp{}, Users: []UserSummary{}}
+
+	if kind != searchTypeUsers {
+		dbChirps, err := cfg.searchChirps(r, viewer, query, sort == searchSortRelevance, limit, offset)
+		if err != nil {
+			fmt.Println("error searching chirps: ", err)
+			respondWithError(w, 500, "failed to search")
+			return
+		}
+		results.Chirps, err = cfg.chirpsToJSON(r.Context(), viewer, dbChirps)
+		if err != nil {
+			fmt.Println("error building chirps response: ", err)
+			respondWithError(w, 500, "failed to search")
+			return
+		}
+	}
+
+	// handles are one word, so quotes and an @ in front don't mean anything
+	handle := chirptext.NormalizeHandle(strings.TrimPrefix(strings.ReplaceAll(query.Text, `"`, ""), "@"))
+	if kind != searchTypeChirps && handle != "" {
+		rows, err := cfg.dbQueries.SearchUsers(r.Context(), database.SearchUsersParams{
+			Pattern:  likeEscaper.Replace(handle),
+			Query:    handle,
+			ViewerID: viewer,
+			Limit:    limit,
+			Offset:   offset,
+		})
+		if err != nil {
+			fmt.Println("error searching users: ", err)
+			respondWithError(w, 500, "failed to search")
+			return
+		}
+		for i := range rows {
+			results.Users = append(results.Users, UserSummary{
+				ID:        rows[i].ID,
+				Handle:    rows[i].Handle,
+				CreatedAt: rows[i].CreatedAt,
+			})
+		}
+	}
+
+	respondWithJSON(w, 200, results)
+}
+
+// searchChirps runs the chirp half of a search. A from: handle nobody has
+// finds nothing rather than everything.
+func (cfg *apiConfig) searchChirps(r *http.Request, viewer uuid.UUID, query search.Query, byRelevance bool, limit, offset int32) ([]database.Chirp, error) {
+	params := database.SearchChirpsParams{
+		Query:    query.Text,
+		ViewerID: viewer,
+		// ranking needs words to rank by
+		ByRelevance: byRelevance && query.Text != "",
+		Limit:       limit,
+		Offset:      offset,
+	}
+	if query.From != "" {
+		authors, err := cfg.dbQueries.GetUsersByHandles(r.Context(), []string{chirptext.NormalizeHandle(query.From)})
+		if err != nil {
+			return nil, err
+		}
+		if len(authors) == 0 {
+			return nil, nil
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authors[0].ID, Valid: true}
+	}
+	if !query.Since.IsZero() {
+		params.Since = sql.NullTime{Time: query.Since, Valid: true}
+	}
+	if !query.Until.IsZero() {
+		params.Until = sql.NullTime{Time: query.Until, Valid: true}
+	}
+	return cfg.dbQueries.SearchChirps(r.Context(), params)
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/auth"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+	"github.com/whatsmynameagain/go-chirpy/internal/realtime"
+	"github.com/whatsmynameagain/go-chirpy/internal/websocket"
+
+	"github.com/google/uuid"
+)
+
+// GET /api/ws is the realtime API for clients that want one connection for
+// everything. It carries the same events as GET /api/stream, as JSON text
+// messages, for the channels the client subscribes to: its timeline, its
+// notifications, its direct messages and any threads it has open.
+//
+// From the client:
+//
+//	{"type": "auth", "token": "<jwt>"}
+//	{"type": "subscribe", "channel": "timeline", "ref": "1"}
+//	{"type": "subscribe", "channel": "thread", "chirp_id": "<id>", "ref": "2"}
+//	{"type": "unsubscribe", "channel": "notifications"}
+//	{"type": "ping"}
+//
+// From the server:
+//
+//	{"type": "event", "channel": "timeline", "id": 41, "event": "chirp.created", "data": {...}}
+//	{"type": "ack", "ref": "1"} or {"type": "error", "ref": "2", "message": "..."}
+//	{"type": "pong"}
+//	{"type": "resync"}, the connection fell behind and skipped events
+//
+// The token goes in the Authorization header, or, since browsers can't set
+// headers on a websocket, in an auth message within socketAuthTimeout of
+// connecting. Sending a fresh auth message before the token expires keeps
+// the connection open, otherwise it's closed when the token runs out.
+
+const (
+	socketAuthTimeout  = 10 * time.Second
+	socketPingInterval = 30 * time.Second
+	// a connection that hasn't sent anything, pongs included, for this long
+	// is dead
+	socketReadTimeout = 2 * socketPingInterval
+	// a client that can't take a message in this long is dropped
+	socketWriteTimeout   = 10 * time.Second
+	socketMaxMessageSize = 4096
+	// replies queued for the writer
+	socketReplyBuffer = 16
+	socketMaxThreads  = 50
+
+	// messages a client may send per second on average, and in a burst
+	socketRateLimit = 5
+	socketRateBurst = 20
+	// rate limited messages in a row before the connection is closed
+	socketMaxViolations = 20
+
+	// application close code (RFC 6455 7.4.2) for failed, missing or
+	// expired authentication
+	socketCloseUnauthorized = 4001
+
+	channelTimeline      = "timeline"
+	channelNotifications = "notifications"
+	channelMessages      = "messages"
+	channelThread        = "thread"
+)
+
+var errSocketNotFound = errors.New("no chirp found with the requested ID")
+
+type socketRequest struct {
+	Type    string    `json:"type"`
+	Ref     string    `json:"ref"`
+	Token   string    `json:"token"`
+	Channel string    `json:"channel"`
+	ChirpID uuid.UUID `json:"chirp_id"`
+}
+
+type socketMessage struct {
+	Type    string          `json:"type"`
+	Ref     string          `json:"ref,omitempty"`
+	Channel string          `json:"channel,omitempty"`
+	ChirpID *uuid.UUID      `json:"chirp_id,omitempty"`
+	ID      int64           `json:"id,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// tokenBucket lets through rate events a second on average, up to burst at
+// once
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) tokenBucket {
+	return tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// socketClient is one connection. The handler's goroutine reads, a second
+// one does all the writing; replies go from one to the other through
+// replies, and the subscription state is shared under mu.
+type socketClient struct {
+	cfg     *apiConfig
+	conn    *websocket.Conn
+	replies chan socketMessage
+
+	mu            sync.Mutex
+	expiresAt     time.Time
+	filter        streamFilter
+	timeline      bool
+	notifications bool
+	messages      bool
+	threads       map[uuid.UUID]bool
+
+	// only touched by the reader
+	limiter    tokenBucket
+	violations int
+}
+
+func (c *socketClient) loggedIn() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.filter.viewer != uuid.Nil
+}
+
+// serveSocket is GET /api/ws
+func (cfg *apiConfig) serveSocket(w http.ResponseWriter, r *http.Request) {
+	var (
+		user  database.User
+		token string
+		err   error
+	)
+	if r.Header.Get("Authorization") != "" {
+		user, err = cfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		token, _ = auth.GetBearerToken(r.Header)
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		// Upgrade already answered
+		return
+	}
+	conn.SetMaxMessageSize(socketMaxMessageSize)
+
+	c := &socketClient{
+		cfg:     cfg,
+		conn:    conn,
+		replies: make(chan socketMessage, socketReplyBuffer),
+		threads: map[uuid.UUID]bool{},
+		limiter: newTokenBucket(socketRateLimit, socketRateBurst),
+	}
+	// the request's context ends when this handler returns, which is when
+	// the connection is done
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	if token != "" {
+		err = c.login(ctx, user, token)
+		if err != nil {
+			fmt.Println("error starting websocket: ", err)
+			c.closeWith(websocket.CloseInternalError, "failed to start")
+			conn.Close()
+			return
+		}
+	}
+
+	writerDone := make(chan struct{})
+	go func() {
+		c.writeLoop(ctx)
+		close(writerDone)
+	}()
+	c.readLoop(ctx)
+	cancel()
+	<-writerDone
+	conn.Close()
+}
+
+// login sets who the connection is for and loads what their events are
+// filtered by. Logging in again is only for swapping in a fresh token.
+func (c *socketClient) login(ctx context.Context, user database.User, token string) error {
+	claims, err := auth.ParseJWT(token, c.cfg.secret)
+	if err != nil {
+		return err
+	}
+
+	filter := streamFilter{viewer: user.ID, timeline: true}
+	err = c.cfg.loadStreamFilter(ctx, &filter)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filter = filter
+	c.expiresAt = claims.ExpiresAt.Time
+	return nil
+}
+
+// closeWith starts the closing handshake, the reader sees the client's
+// answer (or the connection going away) and ends the connection
+func (c *socketClient) closeWith(code int, reason string) {
+	c.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	c.conn.WriteClose(code, reason)
+}
+
+func (c *socketClient) reply(ctx context.Context, msg socketMessage) {
+	select {
+	case c.replies <- msg:
+	case <-ctx.Done():
+	}
+}
+
+func (c *socketClient) readLoop(ctx context.Context) {
+	// until the client logs in only the auth timeout applies, after that
+	// pongs and messages keep the connection alive
+	if c.loggedIn() {
+		c.conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+	} else {
+		c.conn.SetReadDeadline(time.Now().Add(socketAuthTimeout))
+	}
+	c.conn.SetPongHandler(func([]byte) {
+		if c.loggedIn() {
+			c.conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+		}
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if c.loggedIn() {
+					c.closeWith(websocket.CloseGoingAway, "connection timed out")
+				} else {
+					c.closeWith(socketCloseUnauthorized, "authentication timed out")
+				}
+			}
+			return
+		}
+		if c.loggedIn() {
+			c.conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+		}
+
+		if !c.limiter.allow(time.Now()) {
+			c.violations++
+			if c.violations >= socketMaxViolations {
+				c.closeWith(websocket.ClosePolicyViolation, "rate limit exceeded")
+				return
+			}
+			c.reply(ctx, socketMessage{Type: "error", Message: "rate limit exceeded, slow down"})
+			continue
+		}
+		c.violations = 0
+
+		req := socketRequest{}
+		err = json.Unmarshal(data, &req)
+		if err != nil {
+			c.reply(ctx, socketMessage{Type: "error", Message: "could not unmarshal message"})
+			continue
+		}
+		if !c.handle(ctx, &req) {
+			return
+		}
+	}
+}
+
+// handle answers one client message, false means the connection is being
+// closed
+func (c *socketClient) handle(ctx context.Context, req *socketRequest) bool {
+	fail := func(msg string) bool {
+		c.reply(ctx, socketMessage{Type: "error", Ref: req.Ref, Message: msg})
+		return true
+	}
+
+	switch req.Type {
+	case "ping":
+		c.reply(ctx, socketMessage{Type: "pong", Ref: req.Ref})
+		return true
+	case "auth":
+		return c.handleAuth(ctx, req)
+	case "subscribe", "unsubscribe":
+	default:
+		return fail("unknown message type")
+	}
+
+	if !c.loggedIn() {
+		return fail("authenticate first")
+	}
+
+	subscribe := req.Type == "subscribe"
+	switch req.Channel {
+	case channelTimeline:
+		c.mu.Lock()
+		c.timeline = subscribe
+		c.mu.Unlock()
+	case channelNotifications:
+		c.mu.Lock()
+		c.notifications = subscribe
+		c.mu.Unlock()
+	case channelMessages:
+		c.mu.Lock()
+		c.messages = subscribe
+		c.mu.Unlock()
+	case channelThread:
+		err := c.setThread(ctx, req.ChirpID, subscribe)
+		if err != nil {
+			if errors.Is(err, errSocketNotFound) || errors.Is(err, errTooManyThreads) {
+				return fail(err.Error())
+			}
+			fmt.Println("error subscribing to thread: ", err)
+			return fail("failed to subscribe to thread")
+		}
+	default:
+		return fail("unknown channel")
+	}
+	c.reply(ctx, socketMessage{Type: "ack", Ref: req.Ref})
+	return true
+}
+
+func (c *socketClient) handleAuth(ctx context.Context, req *socketRequest) bool {
+	user, err := c.cfg.authenticateToken(ctx, req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, errAccountSuspended):
+			c.closeWith(socketCloseUnauthorized, errAccountSuspended.Error())
+			return false
+		case errors.Is(err, errInvalidToken), errors.Is(err, sql.ErrNoRows):
+			c.closeWith(socketCloseUnauthorized, "invalid token")
+			return false
+		}
+		// our fault, not the token's: keep the connection so it can retry
+		fmt.Println("error authenticating websocket: ", err)
+		c.reply(ctx, socketMessage{Type: "error", Ref: req.Ref, Message: "failed to authenticate"})
+		return true
+	}
+
+	c.mu.Lock()
+	current := c.filter.viewer
+	c.mu.Unlock()
+	if current != uuid.Nil && current != user.ID {
+		c.reply(ctx, socketMessage{Type: "error", Ref: req.Ref, Message: "token is for a different user"})
+		return true
+	}
+
+	err = c.login(ctx, user, req.Token)
+	if err != nil {
+		fmt.Println("error logging in websocket: ", err)
+		c.reply(ctx, socketMessage{Type: "error", Ref: req.Ref, Message: "failed to authenticate"})
+		return true
+	}
+	c.conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+	c.reply(ctx, socketMessage{Type: "ack", Ref: req.Ref})
+	return true
+}
+
+var errTooManyThreads = fmt.Errorf("can't follow more than %d threads at once", socketMaxThreads)
+
+// setThread subscribes to or unsubscribes from the conversation a chirp is
+// in, whichever chirp of it is given
+func (c *socketClient) setThread(ctx context.Context, chirpID uuid.UUID, subscribe bool) error {
+	chrp, err := c.cfg.dbQueries.GetChirpByID(ctx, chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errSocketNotFound
+		}
+		return err
+	}
+	root := conversationRoot(&chrp)
+
+	c.mu.Lock()
+	viewer := c.filter.viewer
+	c.mu.Unlock()
+
+	if subscribe {
+		blocked, err := c.cfg.blockedBetween(ctx, viewer, chrp.UserID)
+		if err != nil {
+			return err
+		}
+		visible, err := c.cfg.canViewChirp(ctx, viewer, &chrp)
+		if err != nil {
+			return err
+		}
+		if blocked || !visible {
+			return errSocketNotFound
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !subscribe {
+		delete(c.threads, root)
+		return nil
+	}
+	if !c.threads[root] && len(c.threads) >= socketMaxThreads {
+		return errTooManyThreads
+	}
+	c.threads[root] = true
+	return nil
+}
+
+// channelsFor is which of the connection's channels an event goes to
+func (c *socketClient) channelsFor(e *realtime.Event) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e.Recipients != nil {
+		if !slices.Contains(e.Recipients, c.filter.viewer) {
+			return nil
+		}
+		if e.Type == eventNotification {
+			if c.notifications {
+				return []string{channelNotifications}
+			}
+		} else if c.messages {
+			return []string{channelMessages}
+		}
+		return nil
+	}
+	if c.filter.viewer == uuid.Nil || c.filter.blocks(e) || !c.filter.sees(e) {
+		return nil
+	}
+
+	var channels []string
+	if c.timeline && c.filter.allows(e) {
+		channels = append(channels, channelTimeline)
+	}
+	if c.threads[e.Thread] {
+		channels = append(channels, channelThread)
+	}
+	return channels
+}
+
+func (c *socketClient) write(msg socketMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// writeLoop sends replies, events and pings until ctx is done or a write
+// fails. A client that reads too slowly first holds up its own writes, then
+// falls behind on the hub, which drops it: it gets a resync and carries on
+// from the newest events.
+func (c *socketClient) writeLoop(ctx context.Context) {
+	sub, _, _ := c.cfg.events.Subscribe(false, 0)
+	defer func() { sub.Close() }()
+
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+	refresh := time.NewTicker(streamRefreshInterval)
+	defer refresh.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+
+		case msg := <-c.replies:
+			err = c.write(msg)
+
+		case e, open := <-sub.Events():
+			if !open {
+				sub, _, _ = c.cfg.events.Subscribe(false, 0)
+				err = c.write(socketMessage{Type: "resync"})
+				break
+			}
+			for _, channel := range c.channelsFor(&e) {
+				msg := socketMessage{
+					Type:    "event",
+					Channel: channel,
+					ID:      e.ID,
+					Event:   e.Type,
+					Data:    e.Data,
+				}
+				if channel == channelThread {
+					msg.ChirpID = &e.Thread
+				}
+				err = c.write(msg)
+				if err != nil {
+					break
+				}
+			}
+
+		case <-ping.C:
+			c.mu.Lock()
+			expired := !c.expiresAt.IsZero() && time.Now().After(c.expiresAt)
+			c.mu.Unlock()
+			if expired {
+				c.closeWith(socketCloseUnauthorized, "token expired")
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+			err = c.conn.WritePing(nil)
+
+		case <-refresh.C:
+			c.refreshFilter(ctx)
+		}
+
+		if err != nil {
+			// a write timing out leaves the connection unusable, closing it
+			// stops the reader too
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// refreshFilter reloads the follows, blocks and mutes, keeping the old ones
+// if that fails
+func (c *socketClient) refreshFilter(ctx context.Context) {
+	c.mu.Lock()
+	filter := streamFilter{viewer: c.filter.viewer, timeline: true}
+	c.mu.Unlock()
+	if filter.viewer == uuid.Nil {
+		return
+	}
+
+	err := c.cfg.loadStreamFilter(ctx, &filter)
+	if err != nil {
+		fmt.Println("error refreshing websocket filter: ", err)
+		return
+	}
+	c.mu.Lock()
+	c.filter = filter
+	c.mu.Unlock()
+}
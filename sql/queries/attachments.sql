@@ -0,0 +1,54 @@
+-- name: CreateAttachment :one
+INSERT INTO attachments (id, user_id, created_at, content_type, size_bytes, width, height, storage_key, thumbnail_key, thumbnail_content_type)
+VALUES ($1, $2, NOW(), $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetAttachmentByID :one
+SELECT * FROM attachments
+WHERE id = $1;
+
+-- name: AttachToChirp :execrows
+-- nothing happens unless the attachment is the user's and has never been
+-- posted
+UPDATE attachments
+SET chirp_id = sqlc.arg(chirp_id), position = sqlc.arg(position), alt_text = sqlc.arg(alt_text)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id) AND position IS NULL;
+
+-- name: GetChirpAttachments :many
+SELECT * FROM attachments
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: GetExpiredAttachments :many
+-- uploads nobody posted since before the cutoff, and attachments whose chirp
+-- was purged or whose scheduled chirp was cancelled. Uploads a draft holds
+-- are kept.
+SELECT * FROM attachments
+WHERE chirp_id IS NULL AND scheduled_chirp_id IS NULL AND created_at < $1
+  AND NOT EXISTS (
+      SELECT 1 FROM drafts
+      WHERE drafts.attachments @> jsonb_build_array(jsonb_build_object('id', attachments.id))
+  )
+ORDER BY created_at
+LIMIT $2;
+
+-- name: DeleteAttachment :exec
+DELETE FROM attachments
+WHERE id = $1;
+
+-- name: AttachToScheduledChirp :execrows
+-- AttachToChirp for a chirp that's scheduled, MoveScheduledAttachments puts
+-- them on the chirp once it's published
+UPDATE attachments
+SET scheduled_chirp_id = sqlc.arg(scheduled_chirp_id), position = sqlc.arg(position), alt_text = sqlc.arg(alt_text)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id) AND position IS NULL;
+
+-- name: GetScheduledChirpAttachments :many
+SELECT * FROM attachments
+WHERE scheduled_chirp_id = ANY(sqlc.arg(scheduled_chirp_ids)::uuid[])
+ORDER BY scheduled_chirp_id, position;
+
+-- name: MoveScheduledAttachments :exec
+UPDATE attachments
+SET chirp_id = sqlc.arg(chirp_id), scheduled_chirp_id = NULL
+WHERE scheduled_chirp_id = sqlc.arg(scheduled_chirp_id);
@@ -0,0 +1,47 @@
+-- name: CreateBlock :execrows
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: DeleteBlock :exec
+DELETE FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: IsBlocked :one
+-- whether either user has blocked the other
+SELECT blocked_between(sqlc.arg(user_a)::uuid, sqlc.arg(user_b)::uuid) AS blocked;
+
+-- name: GetBlockedUserIDs :many
+-- everyone the user has blocked or been blocked by
+SELECT blocked_id AS user_id FROM blocks
+WHERE blocker_id = $1
+UNION
+SELECT blocker_id FROM blocks
+WHERE blocked_id = $1;
+
+-- name: GetBlocks :many
+SELECT users.id, users.handle, users.created_at, blocks.created_at AS blocked_at FROM blocks
+JOIN users ON users.id = blocks.blocked_id
+WHERE blocks.blocker_id = $1
+ORDER BY blocks.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: CreateMute :exec
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (muter_id, muted_id) DO NOTHING;
+
+-- name: DeleteMute :exec
+DELETE FROM mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: GetMutes :many
+SELECT users.id, users.handle, users.created_at, mutes.created_at AS muted_at FROM mutes
+JOIN users ON users.id = mutes.muted_id
+WHERE mutes.muter_id = $1
+ORDER BY mutes.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetMutedUserIDs :many
+SELECT muted_id FROM mutes
+WHERE muter_id = $1;
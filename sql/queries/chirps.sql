@@ -1,18 +1,132 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, flagged_at, flag_reason, in_reply_to, root_id, quote_of, visibility)
     VALUES (
         gen_random_uuid(),
         NOW(),
         NOW(),
         $1,
-        $2
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        $8
     )
 RETURNING *;
 
 -- name: GetAllChirps :many
+-- unlisted chirps stay out, like in every public listing
 SELECT * FROM chirps
+WHERE deleted_at IS NULL AND NOT blocked_between(user_id, $1)
+  AND visibility <> 'unlisted'
+  AND can_view_chirp(id, user_id, visibility, $1)
 ORDER BY created_at ASC;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
-WHERE chirps.id = $1;
\ No newline at end of file
+WHERE chirps.id = $1;
+
+-- name: DeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at > $2
+RETURNING *;
+
+-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1;
+
+-- name: GetChirpByIDForUpdate :one
+SELECT * FROM chirps
+WHERE chirps.id = $1
+FOR UPDATE;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = sqlc.arg(body),
+    updated_at = NOW(),
+    flagged_at = COALESCE(sqlc.narg(flagged_at), flagged_at),
+    flag_reason = COALESCE(sqlc.narg(flag_reason), flag_reason)
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.* FROM chirps AS parent
+    WHERE parent.id = (SELECT c.in_reply_to FROM chirps AS c WHERE c.id = $1)
+    UNION ALL
+    SELECT chirps.* FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to
+)
+SELECT * FROM ancestors
+ORDER BY created_at ASC;
+
+-- name: GetChirpReplies :many
+-- the replies under a chirp down to max_depth levels, only the direct
+-- replies are paginated and each one comes with its whole subtree. Replies by
+-- someone blocked either way, or that the viewer isn't allowed to see, are
+-- left out along with everything under them.
+WITH RECURSIVE thread AS (
+    SELECT top.id, 1 AS depth FROM (
+        SELECT chirps.id FROM chirps
+        WHERE chirps.in_reply_to = sqlc.arg(chirp_id)
+          AND NOT blocked_between(chirps.user_id, sqlc.arg(viewer_id))
+          AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id))
+        ORDER BY chirps.created_at ASC
+        LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset)
+    ) AS top
+    UNION ALL
+    SELECT chirps.id, thread.depth + 1 FROM chirps
+    JOIN thread ON chirps.in_reply_to = thread.id
+    WHERE thread.depth < sqlc.arg(max_depth)::int
+      AND NOT blocked_between(chirps.user_id, sqlc.arg(viewer_id))
+      AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id))
+)
+SELECT sqlc.embed(chirps), thread.depth FROM thread
+JOIN chirps ON chirps.id = thread.id
+ORDER BY thread.depth ASC, chirps.created_at ASC;
+
+-- name: CountReplies :many
+SELECT in_reply_to, COUNT(*) AS reply_count FROM chirps
+WHERE in_reply_to = ANY(sqlc.arg(chirp_ids)::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: CountQuotes :many
+SELECT quote_of, COUNT(*) AS quote_count FROM chirps
+WHERE quote_of = ANY(sqlc.arg(chirp_ids)::uuid[]) AND deleted_at IS NULL
+GROUP BY quote_of;
+
+-- name: GetUserChirps :many
+-- a user's own chirps and their rechirps, newest activity first
+SELECT sqlc.embed(chirps), feed.rechirped_by, feed.activity_at FROM (
+    SELECT own.id AS chirp_id, NULL::uuid AS rechirped_by, own.created_at AS activity_at
+    FROM chirps AS own
+    WHERE own.user_id = sqlc.arg(user_id)
+    UNION ALL
+    SELECT rechirps.chirp_id, rechirps.user_id, rechirps.created_at
+    FROM rechirps
+    WHERE rechirps.user_id = sqlc.arg(user_id)
+) AS feed
+JOIN chirps ON chirps.id = feed.chirp_id
+WHERE chirps.deleted_at IS NULL
+  AND NOT blocked_between(chirps.user_id, sqlc.arg(viewer_id))
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id))
+ORDER BY feed.activity_at DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: GetViewableChirpIDs :many
+-- which of the given chirps the viewer is allowed to see, blocks aside
+SELECT chirps.id FROM chirps
+WHERE chirps.id = ANY(sqlc.arg(ids)::uuid[])
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id));
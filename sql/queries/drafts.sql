@@ -0,0 +1,35 @@
+-- name: CreateDraft :one
+-- attachments and poll are JSON text, lib/pq would send bytes as bytea
+INSERT INTO drafts (id, user_id, created_at, updated_at, body, visibility, in_reply_to, quote_of, attachments, poll)
+VALUES (
+    gen_random_uuid(), sqlc.arg(user_id), NOW(), NOW(), sqlc.arg(body), sqlc.arg(visibility),
+    sqlc.narg(in_reply_to), sqlc.narg(quote_of), sqlc.arg(attachments)::text::jsonb, sqlc.arg(poll)::text::jsonb
+)
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDrafts :many
+-- the user's drafts, the last one worked on first
+SELECT * FROM drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC, id
+LIMIT $2 OFFSET $3;
+
+-- name: UpdateDraft :one
+UPDATE drafts
+SET body = sqlc.arg(body),
+    visibility = sqlc.arg(visibility),
+    in_reply_to = sqlc.narg(in_reply_to),
+    quote_of = sqlc.narg(quote_of),
+    attachments = sqlc.arg(attachments)::text::jsonb,
+    poll = sqlc.arg(poll)::text::jsonb,
+    updated_at = NOW()
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts
+WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,67 @@
+-- name: CreateFollow :execrows
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: DeleteFollow :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: CountFollowers :one
+SELECT COUNT(*) FROM follows
+WHERE followee_id = $1;
+
+-- name: CountFollowing :one
+SELECT COUNT(*) FROM follows
+WHERE follower_id = $1;
+
+-- name: GetFollowers :many
+SELECT users.id, users.handle, users.created_at, follows.created_at AS followed_at FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = sqlc.arg(followee_id)
+  AND NOT blocked_between(users.id, sqlc.arg(viewer_id))
+ORDER BY follows.created_at DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: GetFollowing :many
+SELECT users.id, users.handle, users.created_at, follows.created_at AS followed_at FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = sqlc.arg(follower_id)
+  AND NOT blocked_between(users.id, sqlc.arg(viewer_id))
+ORDER BY follows.created_at DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: GetFolloweeIDs :many
+SELECT followee_id FROM follows
+WHERE follower_id = $1;
+
+-- name: IsFollowing :one
+SELECT EXISTS (
+    SELECT 1 FROM follows
+    WHERE follower_id = $1 AND followee_id = $2
+) AS following;
+
+-- name: CreateFollowRequest :execrows
+INSERT INTO follow_requests (requester_id, target_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (requester_id, target_id) DO NOTHING;
+
+-- name: DeleteFollowRequest :execrows
+DELETE FROM follow_requests
+WHERE requester_id = $1 AND target_id = $2;
+
+-- name: CountFollowRequests :one
+SELECT COUNT(*) FROM follow_requests
+WHERE target_id = $1;
+
+-- name: GetFollowRequests :many
+-- the requests waiting on a protected account, newest first
+SELECT users.id, users.handle, users.created_at, follow_requests.created_at AS requested_at FROM follow_requests
+JOIN users ON users.id = follow_requests.requester_id
+WHERE follow_requests.target_id = $1
+ORDER BY follow_requests.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetFollowRequesterIDs :many
+SELECT requester_id FROM follow_requests
+WHERE target_id = $1;
@@ -0,0 +1,56 @@
+-- name: CreateChirpHashtags :exec
+INSERT INTO chirp_hashtags (chirp_id, tag, created_at)
+SELECT sqlc.arg(chirp_id)::uuid, tag, sqlc.arg(created_at)::timestamp
+FROM unnest(sqlc.arg(tags)::text[]) AS tag
+ON CONFLICT (chirp_id, tag) DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: GetHashtagChirps :many
+SELECT chirps.* FROM chirp_hashtags
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE chirp_hashtags.tag = sqlc.arg(tag)
+  AND (chirp_hashtags.created_at, chirp_hashtags.chirp_id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+  AND chirps.deleted_at IS NULL
+  AND NOT blocked_between(chirps.user_id, sqlc.arg(viewer_id))
+  AND chirps.visibility <> 'unlisted'
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id))
+ORDER BY chirp_hashtags.created_at DESC, chirp_hashtags.chirp_id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: ClearTrendingHashtags :exec
+DELETE FROM trending_hashtags;
+
+-- name: RefreshTrendingHashtags :execrows
+-- counts each tag's uses in the current window and the one before it, tags
+-- used fewer than min_uses times in the current window are left out. Only
+-- public chirps from accounts that aren't protected count, the others would
+-- give away what they're about.
+INSERT INTO trending_hashtags (tag, uses, previous_uses, refreshed_at)
+SELECT chirp_hashtags.tag,
+    COUNT(*) FILTER (WHERE chirp_hashtags.created_at >= sqlc.arg(window_start)::timestamp),
+    COUNT(*) FILTER (WHERE chirp_hashtags.created_at < sqlc.arg(window_start)::timestamp),
+    NOW()
+FROM chirp_hashtags
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE chirp_hashtags.created_at >= sqlc.arg(previous_window_start)::timestamp
+  AND chirps.deleted_at IS NULL
+  AND chirps.visibility = 'public'
+  AND NOT users.protected
+GROUP BY chirp_hashtags.tag
+HAVING COUNT(*) FILTER (WHERE chirp_hashtags.created_at >= sqlc.arg(window_start)::timestamp) >= sqlc.arg(min_uses)::int;
+
+-- name: GetTrendingHashtags :many
+-- fastest growing first: the jump from the previous window to this one
+SELECT * FROM trending_hashtags
+ORDER BY uses - previous_uses DESC, uses DESC, tag ASC
+LIMIT $1 OFFSET $2;
+
+-- name: GetChirpsToReindex :many
+-- every chirp that's still up, whoever can see it
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+ORDER BY created_at ASC;
@@ -0,0 +1,28 @@
+-- name: CreateLike :execrows
+INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteLike :exec
+DELETE FROM likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: CountLikes :many
+SELECT chirp_id, COUNT(*) AS like_count FROM likes
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+GROUP BY chirp_id;
+
+-- name: GetLikedChirpIDs :many
+-- which of the given chirps the user has liked
+SELECT chirp_id FROM likes
+WHERE user_id = sqlc.arg(user_id) AND chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetLikedChirps :many
+SELECT sqlc.embed(chirps), likes.created_at AS liked_at FROM likes
+JOIN chirps ON chirps.id = likes.chirp_id
+WHERE likes.user_id = sqlc.arg(user_id)
+  AND chirps.deleted_at IS NULL
+  AND NOT blocked_between(chirps.user_id, sqlc.arg(viewer_id))
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id))
+ORDER BY likes.created_at DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
@@ -0,0 +1,30 @@
+-- name: CreateChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, handle, created_at)
+SELECT sqlc.arg(chirp_id)::uuid, mentioned.user_id, mentioned.handle, sqlc.arg(created_at)::timestamp
+FROM unnest(sqlc.arg(user_ids)::uuid[], sqlc.arg(handles)::text[]) AS mentioned (user_id, handle)
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetChirpMentions :many
+SELECT * FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetMentionChirps :many
+-- chirps mentioning a user, newest first. Authors the user muted are left out
+-- when it's the user looking.
+SELECT chirps.* FROM chirp_mentions
+JOIN chirps ON chirps.id = chirp_mentions.chirp_id
+WHERE chirp_mentions.user_id = sqlc.arg(user_id)
+  AND (chirp_mentions.created_at, chirp_mentions.chirp_id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+  AND chirps.deleted_at IS NULL
+  AND NOT blocked_between(chirps.user_id, sqlc.arg(viewer_id))
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id))
+  AND (sqlc.arg(viewer_id) <> sqlc.arg(user_id) OR NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg(viewer_id) AND mutes.muted_id = chirps.user_id
+  ))
+ORDER BY chirp_mentions.created_at DESC, chirp_mentions.chirp_id DESC
+LIMIT sqlc.arg(page_limit);
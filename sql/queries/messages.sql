@@ -0,0 +1,114 @@
+-- name: CreateConversation :one
+-- nothing comes back when a one-to-one conversation for the pair already
+-- exists, GetConversationByDirectKey finds it
+INSERT INTO conversations (id, direct_key, created_by, created_at, last_message_at)
+VALUES (gen_random_uuid(), sqlc.narg(direct_key), sqlc.arg(created_by), NOW(), NOW())
+ON CONFLICT (direct_key) DO NOTHING
+RETURNING *;
+
+-- name: GetConversationByDirectKey :one
+SELECT * FROM conversations
+WHERE direct_key = $1;
+
+-- name: AddConversationMembers :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at)
+SELECT sqlc.arg(conversation_id)::uuid, unnest(sqlc.arg(user_ids)::uuid[]), NOW()
+ON CONFLICT (conversation_id, user_id) DO NOTHING;
+
+-- name: GetMemberConversation :one
+-- a conversation, as long as the user is in it
+SELECT conversations.* FROM conversations
+JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversations.id = sqlc.arg(id)
+  AND conversation_members.user_id = sqlc.arg(user_id);
+
+-- name: ListConversations :many
+-- the user's conversations, latest activity first. One-to-one conversations
+-- with someone blocked either way are left out.
+SELECT conversations.* FROM conversations
+JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversation_members.user_id = sqlc.arg(user_id)
+  AND NOT (
+    conversations.direct_key IS NOT NULL AND EXISTS (
+        SELECT 1 FROM conversation_members AS other
+        WHERE other.conversation_id = conversations.id
+          AND other.user_id <> sqlc.arg(user_id)
+          AND blocked_between(other.user_id, sqlc.arg(user_id))
+    )
+  )
+ORDER BY conversations.last_message_at DESC, conversations.id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: GetConversationMembers :many
+SELECT conversation_members.conversation_id, users.id, users.handle, conversation_members.joined_at,
+    conversation_members.last_read_message_id, conversation_members.last_read_at
+FROM conversation_members
+JOIN users ON users.id = conversation_members.user_id
+WHERE conversation_members.conversation_id = ANY(sqlc.arg(conversation_ids)::uuid[])
+ORDER BY conversation_members.conversation_id, conversation_members.joined_at, users.id;
+
+-- name: GetConversationRecipients :many
+-- who in a conversation sees what the user does there: everyone else, apart
+-- from those blocked either way with them
+SELECT user_id FROM conversation_members
+WHERE conversation_id = sqlc.arg(conversation_id)
+  AND user_id <> sqlc.arg(user_id)
+  AND NOT blocked_between(user_id, sqlc.arg(user_id));
+
+-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW())
+RETURNING *;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET last_message_at = sqlc.arg(last_message_at)
+WHERE id = sqlc.arg(id);
+
+-- name: GetMessageByID :one
+SELECT * FROM messages
+WHERE id = $1;
+
+-- name: GetMessages :many
+-- a page of a conversation's history, newest first, leaving out senders
+-- blocked either way with the viewer
+SELECT * FROM messages
+WHERE conversation_id = sqlc.arg(conversation_id)
+  AND (created_at, id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+  AND NOT blocked_between(sender_id, sqlc.arg(viewer_id))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetLatestMessages :many
+-- the newest message the viewer can see in each conversation, for the inbox
+SELECT DISTINCT ON (messages.conversation_id) messages.* FROM messages
+WHERE conversation_id = ANY(sqlc.arg(conversation_ids)::uuid[])
+  AND NOT blocked_between(sender_id, sqlc.arg(viewer_id))
+ORDER BY conversation_id, created_at DESC, id DESC;
+
+-- name: CountUnreadMessages :many
+-- messages from others after the viewer's read receipt, per conversation
+SELECT messages.conversation_id, COUNT(*) AS unread_count FROM messages
+JOIN conversation_members ON conversation_members.conversation_id = messages.conversation_id
+    AND conversation_members.user_id = sqlc.arg(viewer_id)
+LEFT JOIN messages AS last_read ON last_read.id = conversation_members.last_read_message_id
+WHERE messages.conversation_id = ANY(sqlc.arg(conversation_ids)::uuid[])
+  AND messages.sender_id <> sqlc.arg(viewer_id)
+  AND (last_read.id IS NULL OR (messages.created_at, messages.id) > (last_read.created_at, last_read.id))
+  AND NOT blocked_between(messages.sender_id, sqlc.arg(viewer_id))
+GROUP BY messages.conversation_id;
+
+-- name: MarkConversationRead :execrows
+-- moves the read receipt up to a message, never back
+UPDATE conversation_members
+SET last_read_message_id = messages.id, last_read_at = NOW()
+FROM messages
+WHERE conversation_members.conversation_id = sqlc.arg(conversation_id)
+  AND conversation_members.user_id = sqlc.arg(user_id)
+  AND messages.id = sqlc.arg(message_id)
+  AND messages.conversation_id = conversation_members.conversation_id
+  AND NOT EXISTS (
+    SELECT 1 FROM messages AS last_read
+    WHERE last_read.id = conversation_members.last_read_message_id
+      AND (last_read.created_at, last_read.id) >= (messages.created_at, messages.id)
+  );
@@ -0,0 +1,75 @@
+-- name: UpsertNotification :one
+-- starts a notification or joins the unread one in the same group. Nothing
+-- comes back when the recipient turned the type off, muted the actor, or the
+-- two have blocked each other.
+INSERT INTO notifications (id, user_id, type, chirp_id, group_key, created_at, updated_at)
+SELECT gen_random_uuid(), sqlc.arg(user_id)::uuid, sqlc.arg(type)::text, sqlc.narg(chirp_id)::uuid, sqlc.arg(group_key)::text, NOW(), NOW()
+WHERE NOT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE notification_preferences.user_id = sqlc.arg(user_id)
+      AND notification_preferences.type = sqlc.arg(type)
+      AND NOT notification_preferences.enabled
+)
+  AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg(user_id) AND mutes.muted_id = sqlc.arg(actor_id)
+  )
+  AND NOT blocked_between(sqlc.arg(user_id), sqlc.arg(actor_id))
+ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+DO UPDATE SET updated_at = NOW()
+RETURNING id;
+
+-- name: AddNotificationActor :exec
+INSERT INTO notification_actors (notification_id, actor_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = NOW();
+
+-- name: GetNotificationByID :one
+SELECT * FROM notifications
+WHERE id = $1;
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id)
+  AND (NOT sqlc.arg(unread_only)::bool OR read_at IS NULL)
+ORDER BY updated_at DESC, id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: GetNotificationActors :many
+-- the latest few actors of each notification, with how many there are in all
+SELECT actors.notification_id, actors.actor_id, users.handle, actors.actor_count FROM (
+    SELECT notification_actors.*,
+        COUNT(*) OVER (PARTITION BY notification_actors.notification_id) AS actor_count,
+        ROW_NUMBER() OVER (
+            PARTITION BY notification_actors.notification_id
+            ORDER BY notification_actors.created_at DESC
+        ) AS position
+    FROM notification_actors
+    WHERE notification_actors.notification_id = ANY(sqlc.arg(notification_ids)::uuid[])
+) AS actors
+JOIN users ON users.id = actors.actor_id
+WHERE actors.position <= sqlc.arg(max_actors)::int
+ORDER BY actors.notification_id, actors.created_at DESC;
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2;
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: GetNotificationPreferences :many
+SELECT * FROM notification_preferences
+WHERE user_id = $1;
+
+-- name: SetNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, type, enabled)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled;
@@ -0,0 +1,49 @@
+-- name: CreatePoll :exec
+INSERT INTO polls (chirp_id, closes_at)
+VALUES ($1, $2);
+
+-- name: CreatePollOption :exec
+INSERT INTO poll_options (chirp_id, position, text)
+VALUES ($1, $2, $3);
+
+-- name: GetPolls :many
+SELECT * FROM polls
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetPollOptions :many
+SELECT * FROM poll_options
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: CountPollVotes :many
+SELECT chirp_id, position, COUNT(*) AS vote_count FROM poll_votes
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+GROUP BY chirp_id, position;
+
+-- name: GetPollVotes :many
+-- how the user voted in whichever of the given polls they voted in
+SELECT chirp_id, position FROM poll_votes
+WHERE user_id = sqlc.arg(user_id) AND chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: CreatePollVote :execrows
+-- nothing when the user already voted or the poll is closed. The poll row is
+-- locked so ClosePolls waits for votes in flight, and they for it.
+INSERT INTO poll_votes (chirp_id, user_id, position, created_at)
+SELECT polls.chirp_id, sqlc.arg(user_id)::uuid, sqlc.arg(position)::integer, NOW() FROM polls
+WHERE polls.chirp_id = sqlc.arg(chirp_id) AND polls.closed_at IS NULL
+FOR SHARE
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: ClosePolls :many
+-- closes a batch of polls past their closes_at, SKIP LOCKED keeps concurrent
+-- schedulers on separate batches
+UPDATE polls
+SET closed_at = NOW()
+WHERE chirp_id IN (
+    SELECT chirp_id FROM polls
+    WHERE closed_at IS NULL AND closes_at <= NOW()
+    ORDER BY closes_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING chirp_id;
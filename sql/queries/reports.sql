@@ -0,0 +1,61 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, chirp_id, reporter_id, reason)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: CreateModerationReport :exec
+-- does nothing while the pipeline already has one open on the chirp
+INSERT INTO reports (id, created_at, updated_at, chirp_id, reason)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2
+)
+ON CONFLICT (chirp_id) WHERE reporter_id IS NULL AND status <> 'resolved' DO NOTHING;
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: ListReports :many
+SELECT * FROM reports
+WHERE status = $1
+ORDER BY created_at ASC
+LIMIT $2 OFFSET $3;
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed', claimed_by = $2, claimed_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: ResolveReport :one
+UPDATE reports
+SET status = 'resolved', resolution = $2, resolved_by = $3, resolved_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'claimed' AND claimed_by = $3
+RETURNING *;
+
+-- name: CreateReportDecision :exec
+INSERT INTO report_decisions (id, created_at, report_id, moderator_id, action, note)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: ListReportDecisions :many
+SELECT * FROM report_decisions
+WHERE report_id = $1
+ORDER BY created_at ASC;
@@ -0,0 +1,38 @@
+-- name: CreateScheduledChirp :one
+-- poll is JSON text, lib/pq would send bytes as bytea
+INSERT INTO scheduled_chirps (id, user_id, created_at, updated_at, publish_at, body, visibility, in_reply_to, quote_of, poll)
+VALUES (gen_random_uuid(), $1, NOW(), NOW(), $2, $3, $4, $5, $6, $7::text::jsonb)
+RETURNING *;
+
+-- name: GetScheduledChirps :many
+-- the user's scheduled chirps, the next one to go out first
+SELECT * FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at, id
+LIMIT $2 OFFSET $3;
+
+-- name: RescheduleChirp :one
+-- also gives a chirp that failed to publish another go
+UPDATE scheduled_chirps
+SET publish_at = sqlc.arg(publish_at), failed_reason = NULL, updated_at = NOW()
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2;
+
+-- name: ClaimDueScheduledChirp :one
+-- the scheduled chirp that's been due the longest that no other instance is
+-- publishing. The row stays locked until the transaction publishing it
+-- deletes it, which is what makes it go out only once.
+SELECT * FROM scheduled_chirps
+WHERE publish_at <= NOW() AND failed_reason IS NULL
+ORDER BY publish_at
+FOR UPDATE SKIP LOCKED
+LIMIT 1;
+
+-- name: FailScheduledChirp :exec
+UPDATE scheduled_chirps
+SET failed_reason = $1, updated_at = NOW()
+WHERE id = $2;
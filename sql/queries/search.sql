@@ -0,0 +1,36 @@
+-- name: SearchChirps :many
+-- full-text search over chirp bodies. An empty query matches everything, for
+-- searches that are only operators. Like every public listing it leaves out
+-- unlisted chirps on top of what the viewer can't see.
+SELECT chirps.* FROM chirps
+WHERE chirps.deleted_at IS NULL
+  AND (
+    sqlc.arg(query)::text = ''
+    OR to_tsvector('english', chirps.body) @@ websearch_to_tsquery('english', sqlc.arg(query)::text)
+  )
+  AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id)::uuid)
+  AND (sqlc.narg(since)::timestamp IS NULL OR chirps.created_at >= sqlc.narg(since)::timestamp)
+  AND (sqlc.narg(until)::timestamp IS NULL OR chirps.created_at < sqlc.narg(until)::timestamp)
+  AND chirps.visibility <> 'unlisted'
+  AND NOT blocked_between(chirps.user_id, sqlc.arg(viewer_id))
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(viewer_id))
+ORDER BY
+    CASE WHEN sqlc.arg(by_relevance)::bool
+        THEN ts_rank_cd(to_tsvector('english', chirps.body), websearch_to_tsquery('english', sqlc.arg(query)::text))
+    END DESC NULLS LAST,
+    chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: SearchUsers :many
+-- handles containing the text (pattern is it lowercased, with the LIKE
+-- wildcards escaped) or close to it, closest first. Suspended accounts and
+-- anyone blocked either way are left out.
+SELECT users.id, users.handle, users.created_at FROM users
+WHERE (
+    lower(users.handle) LIKE '%' || sqlc.arg(pattern)::text || '%'
+    OR lower(users.handle) % sqlc.arg(query)::text
+  )
+  AND users.suspended_at IS NULL
+  AND NOT blocked_between(users.id, sqlc.arg(viewer_id))
+ORDER BY similarity(lower(users.handle), sqlc.arg(query)::text) DESC, users.handle ASC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
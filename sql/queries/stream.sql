@@ -0,0 +1,8 @@
+-- name: PublishEvent :exec
+-- NOTIFY is only sent when the transaction commits, so an event published in
+-- one never goes out for work that was rolled back
+SELECT pg_notify('chirpy_events', json_build_object(
+    'id', nextval('stream_event_id_seq'),
+    'type', sqlc.arg(type)::text,
+    'data', sqlc.arg(data)::text::json
+)::text);
@@ -0,0 +1,138 @@
+-- name: GetHomeTimeline :many
+-- chirps by the user and everyone they follow, newest first, starting right
+-- after the (created_at, id) cursor. Each author's newest chirps come off
+-- chirps_user_id_created_at_idx with their own LIMIT, then get merged.
+-- Muted accounts and chirps the user isn't allowed to see are left out.
+SELECT timeline.* FROM (
+    SELECT follows.followee_id AS author_id FROM follows
+    WHERE follows.follower_id = sqlc.arg(user_id)
+      AND NOT EXISTS (
+        SELECT 1 FROM mutes
+        WHERE mutes.muter_id = follows.follower_id AND mutes.muted_id = follows.followee_id
+      )
+    UNION ALL
+    SELECT sqlc.arg(user_id)::uuid
+) AS authors
+CROSS JOIN LATERAL (
+    SELECT * FROM chirps
+    WHERE chirps.user_id = authors.author_id
+      AND chirps.deleted_at IS NULL
+      AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(user_id))
+      AND (chirps.created_at, chirps.id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+    ORDER BY chirps.created_at DESC, chirps.id DESC
+    LIMIT sqlc.arg(page_limit)
+) AS timeline
+ORDER BY timeline.created_at DESC, timeline.id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetMaterializedTimeline :many
+SELECT chirps.* FROM timeline_entries
+JOIN chirps ON chirps.id = timeline_entries.chirp_id
+WHERE timeline_entries.user_id = sqlc.arg(user_id)
+  AND (timeline_entries.created_at, timeline_entries.chirp_id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+  AND chirps.deleted_at IS NULL
+  AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(user_id))
+  AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = timeline_entries.user_id AND mutes.muted_id = timeline_entries.author_id
+  )
+ORDER BY timeline_entries.created_at DESC, timeline_entries.chirp_id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetLargeAccountTimeline :many
+-- the read-time half of the hybrid timeline: chirps from followed accounts
+-- with too many followers to fan out, same shape as GetHomeTimeline
+SELECT timeline.* FROM (
+    SELECT follows.followee_id AS author_id FROM follows
+    JOIN users ON users.id = follows.followee_id
+    WHERE follows.follower_id = sqlc.arg(user_id)
+      AND users.follower_count > sqlc.arg(follower_threshold)::int
+      AND NOT EXISTS (
+        SELECT 1 FROM mutes
+        WHERE mutes.muter_id = follows.follower_id AND mutes.muted_id = follows.followee_id
+      )
+) AS authors
+CROSS JOIN LATERAL (
+    SELECT * FROM chirps
+    WHERE chirps.user_id = authors.author_id
+      AND chirps.deleted_at IS NULL
+      AND can_view_chirp(chirps.id, chirps.user_id, chirps.visibility, sqlc.arg(user_id))
+      AND (chirps.created_at, chirps.id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+    ORDER BY chirps.created_at DESC, chirps.id DESC
+    LIMIT sqlc.arg(page_limit)
+) AS timeline
+ORDER BY timeline.created_at DESC, timeline.id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: EnqueueFanout :exec
+INSERT INTO fanout_queue (chirp_id, created_at)
+VALUES ($1, NOW());
+
+-- name: ClaimFanoutJob :one
+-- takes the oldest job no other worker is holding and that hasn't been set
+-- aside, the row stays locked (and comes back if the transaction rolls back)
+-- until the fan-out commits
+DELETE FROM fanout_queue
+WHERE chirp_id = (
+    SELECT fanout_queue.chirp_id FROM fanout_queue
+    WHERE fanout_queue.failed_at IS NULL
+    ORDER BY fanout_queue.created_at
+    FOR UPDATE SKIP LOCKED
+    LIMIT 1
+)
+RETURNING chirp_id;
+
+-- name: RecordFanoutFailure :one
+-- counts a failed attempt at a job, and sets it aside once it's had
+-- max_attempts
+UPDATE fanout_queue
+SET attempts = attempts + 1,
+    failed_at = CASE WHEN attempts + 1 >= sqlc.arg(max_attempts)::integer THEN NOW() END
+WHERE chirp_id = sqlc.arg(chirp_id)
+RETURNING failed_at;
+
+-- name: FanOutChirp :execrows
+-- the author always gets their own chirp, followers only get it when the
+-- author is under the large account threshold
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+SELECT chirps.user_id, chirps.id, chirps.user_id, chirps.created_at FROM chirps
+WHERE chirps.id = sqlc.arg(chirp_id)
+UNION ALL
+SELECT follows.follower_id, chirps.id, chirps.user_id, chirps.created_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE chirps.id = sqlc.arg(chirp_id)
+  AND users.follower_count <= sqlc.arg(follower_threshold)::int
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: BackfillTimeline :exec
+-- puts a newly followed account's recent chirps into the follower's timeline
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+SELECT sqlc.arg(user_id)::uuid, chirps.id, chirps.user_id, chirps.created_at FROM chirps
+WHERE chirps.user_id = sqlc.arg(author_id) AND chirps.deleted_at IS NULL
+ORDER BY chirps.created_at DESC
+LIMIT sqlc.arg(max_entries)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: RemoveAuthorFromTimeline :exec
+DELETE FROM timeline_entries
+WHERE user_id = $1 AND author_id = $2;
+
+-- name: ClearTimeline :exec
+DELETE FROM timeline_entries
+WHERE user_id = $1;
+
+-- name: RebuildTimeline :execrows
+INSERT INTO timeline_entries (user_id, chirp_id, author_id, created_at)
+SELECT sqlc.arg(user_id)::uuid, chirps.id, chirps.user_id, chirps.created_at FROM chirps
+WHERE chirps.deleted_at IS NULL
+  AND (
+    chirps.user_id = sqlc.arg(user_id)
+    OR chirps.user_id IN (
+        SELECT follows.followee_id FROM follows
+        JOIN users ON users.id = follows.followee_id
+        WHERE follows.follower_id = sqlc.arg(user_id)
+          AND users.follower_count <= sqlc.arg(follower_threshold)::int
+    )
+  )
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
@@ -1,11 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
@@ -14,4 +15,38 @@ DELETE FROM users;
 
 -- name: GetUserByEmail :one
 SELECT * FROM users
-WHERE email = $1;
\ No newline at end of file
+WHERE email = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET suspended_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND suspended_at IS NULL;
+
+-- name: AddToFollowerCount :exec
+UPDATE users
+SET follower_count = follower_count + sqlc.arg(delta)::int
+WHERE id = sqlc.arg(id);
+
+-- name: ListUserIDs :many
+SELECT id FROM users
+ORDER BY id;
+
+-- name: UpdateUserHandle :one
+UPDATE users
+SET handle = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUsersByHandles :many
+SELECT * FROM users
+WHERE lower(handle) = ANY(sqlc.arg(handles)::text[]);
+
+-- name: SetUserProtected :one
+UPDATE users
+SET protected = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
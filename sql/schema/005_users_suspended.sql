@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users
+ADD suspended_at TIMESTAMP;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN revoked_at DROP NOT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+ALTER COLUMN revoked_at SET NOT NULL;
+
+ALTER TABLE users
+DROP COLUMN suspended_at;
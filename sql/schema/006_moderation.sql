@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users
+ADD is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE chirps
+ADD flagged_at TIMESTAMP,
+ADD flag_reason TEXT;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN flag_reason,
+DROP COLUMN flagged_at;
+
+ALTER TABLE users
+DROP COLUMN is_admin;
@@ -0,0 +1,46 @@
+-- +goose Up
+CREATE TABLE reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    -- kept when the chirp goes away so the decision stays on record
+    chirp_id UUID REFERENCES chirps(id)
+        ON DELETE SET NULL,
+    -- NULL for reports filed by the moderation pipeline
+    reporter_id UUID REFERENCES users(id)
+        ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'claimed', 'resolved')),
+    claimed_by UUID REFERENCES users(id)
+        ON DELETE SET NULL,
+    claimed_at TIMESTAMP,
+    resolution TEXT
+        CHECK (resolution IN ('dismiss', 'delete_chirp', 'suspend_author')),
+    resolved_by UUID REFERENCES users(id)
+        ON DELETE SET NULL,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at);
+
+-- one open report per user per chirp
+CREATE UNIQUE INDEX reports_open_reporter_idx ON reports (chirp_id, reporter_id)
+    WHERE status <> 'resolved';
+
+CREATE TABLE report_decisions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    report_id UUID NOT NULL REFERENCES reports(id)
+        ON DELETE CASCADE,
+    moderator_id UUID REFERENCES users(id)
+        ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX report_decisions_report_id_idx ON report_decisions (report_id, created_at);
+
+-- +goose Down
+DROP TABLE report_decisions;
+DROP TABLE reports;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD in_reply_to UUID REFERENCES chirps(id)
+    ON DELETE SET NULL,
+-- the chirp that started the conversation, NULL for chirps that aren't replies
+ADD root_id UUID REFERENCES chirps(id)
+    ON DELETE SET NULL;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to, created_at);
+CREATE INDEX chirps_root_id_idx ON chirps (root_id);
+
+-- +goose Down
+DROP INDEX chirps_root_id_idx;
+DROP INDEX chirps_in_reply_to_idx;
+
+ALTER TABLE chirps
+DROP COLUMN root_id,
+DROP COLUMN in_reply_to;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE rechirps (
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX rechirps_chirp_id_idx ON rechirps (chirp_id);
+CREATE INDEX rechirps_user_id_created_at_idx ON rechirps (user_id, created_at);
+
+-- no foreign key on purpose: a quote should still know what it quoted after
+-- the quoted chirp is purged, so it can be shown as deleted
+ALTER TABLE chirps
+ADD quote_of UUID;
+
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of);
+
+-- +goose Down
+DROP INDEX chirps_quote_of_idx;
+
+ALTER TABLE chirps
+DROP COLUMN quote_of;
+
+DROP TABLE rechirps;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE likes (
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    -- one like per user per chirp
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+-- the primary key covers "did this user like these chirps", this one covers
+-- counting likes per chirp
+CREATE INDEX likes_chirp_id_idx ON likes (chirp_id);
+CREATE INDEX likes_user_id_created_at_idx ON likes (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE likes;
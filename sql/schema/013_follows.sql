@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE follows (
+    follower_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows (followee_id, created_at DESC);
+
+-- the timeline reads the newest chirps of each followed account with one
+-- short index scan per account (see GetHomeTimeline), so the cost depends on
+-- how many accounts someone follows rather than on the size of chirps
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at DESC, id DESC)
+    WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX chirps_user_id_created_at_idx;
+DROP TABLE follows;
@@ -0,0 +1,47 @@
+-- +goose Up
+-- kept up to date on follow/unfollow so the fan-out can tell large accounts
+-- apart without counting follows every time
+ALTER TABLE users
+ADD follower_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE users
+SET follower_count = counts.total
+FROM (
+    SELECT followee_id, COUNT(*) AS total FROM follows
+    GROUP BY followee_id
+) AS counts
+WHERE users.id = counts.followee_id;
+
+-- materialized home timelines, filled in by the fan-out workers
+CREATE TABLE timeline_entries (
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    -- the chirp's created_at, copied so reading a page is one index scan
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX timeline_entries_user_id_created_at_idx
+    ON timeline_entries (user_id, created_at DESC, chirp_id DESC);
+-- for dropping an author's chirps on unfollow
+CREATE INDEX timeline_entries_user_id_author_id_idx
+    ON timeline_entries (user_id, author_id);
+
+-- chirps waiting to be fanned out, written in the same transaction as the
+-- chirp itself so a committed chirp always gets delivered
+CREATE TABLE fanout_queue (
+    chirp_id UUID PRIMARY KEY REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE fanout_queue;
+DROP TABLE timeline_entries;
+
+ALTER TABLE users
+DROP COLUMN follower_count;
@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE blocks (
+    blocker_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX blocks_blocked_id_idx ON blocks (blocked_id);
+
+CREATE TABLE mutes (
+    muter_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    muted_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (muter_id, muted_id),
+    CHECK (muter_id <> muted_id)
+);
+
+-- blocks work both ways, so every read path filters with this instead of
+-- spelling out both directions. The EXISTS keeps the planner from inlining
+-- it, so it costs one call, an index lookup on blocks, per row filtered.
+-- +goose StatementBegin
+CREATE FUNCTION blocked_between(a UUID, b UUID) RETURNS BOOLEAN
+LANGUAGE SQL STABLE AS $$
+    SELECT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE (blocker_id = a AND blocked_id = b)
+           OR (blocker_id = b AND blocked_id = a)
+    )
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION blocked_between;
+DROP TABLE mutes;
+DROP TABLE blocks;
@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE chirp_hashtags (
+    chirp_id UUID NOT NULL REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    -- normalized, see chirptext.NormalizeHashtag
+    tag TEXT NOT NULL,
+    -- the chirp's created_at, so a tag page is one index scan
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, tag)
+);
+
+CREATE INDEX chirp_hashtags_tag_created_at_idx
+    ON chirp_hashtags (tag, created_at DESC, chirp_id DESC);
+-- for the trending refresh, which only looks at the last two windows
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags (created_at);
+
+-- recomputed from chirp_hashtags every few minutes by the trending job,
+-- reads never aggregate anything themselves
+CREATE TABLE trending_hashtags (
+    tag TEXT PRIMARY KEY,
+    uses INTEGER NOT NULL,
+    previous_uses INTEGER NOT NULL,
+    refreshed_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE trending_hashtags;
+DROP TABLE chirp_hashtags;
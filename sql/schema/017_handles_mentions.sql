@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE users
+ADD handle TEXT;
+
+-- existing users get a placeholder they can change
+UPDATE users
+SET handle = 'user_' || substr(replace(id::text, '-', ''), 1, 10);
+
+ALTER TABLE users
+ALTER COLUMN handle SET NOT NULL;
+
+-- handles are unique regardless of case, see chirptext.NormalizeHandle
+CREATE UNIQUE INDEX users_handle_idx ON users (lower(handle));
+
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    -- the handle as it was written (normalized), so the mention keeps
+    -- pointing at the same user if they change handles later
+    handle TEXT NOT NULL,
+    -- the chirp's created_at, for the mentions feed
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id)
+);
+
+CREATE INDEX chirp_mentions_user_id_created_at_idx
+    ON chirp_mentions (user_id, created_at DESC, chirp_id DESC);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+DROP INDEX users_handle_idx;
+
+ALTER TABLE users
+DROP COLUMN handle;
@@ -0,0 +1,51 @@
+-- +goose Up
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    -- who gets notified
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    type TEXT NOT NULL
+        CHECK (type IN ('follow', 'mention', 'reply', 'like', 'rechirp')),
+    -- the chirp it's about: the one liked or rechirped, or the reply or
+    -- mention itself. NULL for follows.
+    chirp_id UUID REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    -- notifications with the same key are grouped ("3 people liked your
+    -- chirp") until they're read, see the index below
+    group_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    -- bumped every time someone else joins the group
+    updated_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP
+);
+
+-- only one unread notification per group, new activity on a read one starts
+-- a new group
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, group_key)
+    WHERE read_at IS NULL;
+CREATE INDEX notifications_user_id_updated_at_idx ON notifications (user_id, updated_at DESC);
+
+-- who did it, one row per person in a group
+CREATE TABLE notification_actors (
+    notification_id UUID NOT NULL REFERENCES notifications(id)
+        ON DELETE CASCADE,
+    actor_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (notification_id, actor_id)
+);
+
+-- every type is on unless there's a row turning it off
+CREATE TABLE notification_preferences (
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    type TEXT NOT NULL
+        CHECK (type IN ('follow', 'mention', 'reply', 'like', 'rechirp')),
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notification_actors;
+DROP TABLE notifications;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- ids for realtime events, shared by every instance so a client can resume
+-- on any of them. Events themselves only live in NOTIFY payloads and each
+-- instance's buffer, they're never stored.
+CREATE SEQUENCE stream_event_id_seq;
+
+-- +goose Down
+DROP SEQUENCE stream_event_id_seq;
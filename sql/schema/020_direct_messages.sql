@@ -0,0 +1,45 @@
+-- +goose Up
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY,
+    -- "<smaller user id>:<larger user id>" for one-to-one conversations, so
+    -- a pair only ever has one. NULL for groups.
+    direct_key TEXT UNIQUE,
+    created_by UUID REFERENCES users(id)
+        ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL,
+    -- the inbox is ordered by this
+    last_message_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE messages (
+    id UUID PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES conversations(id)
+        ON DELETE CASCADE,
+    sender_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX messages_conversation_id_created_at_idx
+    ON messages (conversation_id, created_at DESC, id DESC);
+
+CREATE TABLE conversation_members (
+    conversation_id UUID NOT NULL REFERENCES conversations(id)
+        ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    joined_at TIMESTAMP NOT NULL,
+    -- the read receipt: the newest message the member has seen, and when
+    last_read_message_id UUID REFERENCES messages(id)
+        ON DELETE SET NULL,
+    last_read_at TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX conversation_members_user_id_idx ON conversation_members (user_id);
+
+-- +goose Down
+DROP TABLE conversation_members;
+DROP TABLE messages;
+DROP TABLE conversations;
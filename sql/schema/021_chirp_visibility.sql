@@ -0,0 +1,32 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'followers', 'mentioned'));
+
+-- who can see a chirp at all, blocks aside. Public and unlisted chirps are
+-- open to anyone (unlisted ones just stay out of the public listings),
+-- followers-only chirps to followers, and both followers-only and
+-- mentioned-only chirps to the users they mention. Authors always see their
+-- own. Its EXISTS sublinks keep it from being inlined, so it costs one
+-- function call per row it filters.
+-- +goose StatementBegin
+CREATE FUNCTION can_view_chirp(target UUID, author UUID, level TEXT, viewer UUID) RETURNS BOOLEAN
+LANGUAGE SQL STABLE AS $$
+    SELECT level IN ('public', 'unlisted')
+        OR author = viewer
+        OR (level = 'followers' AND EXISTS (
+            SELECT 1 FROM follows
+            WHERE follower_id = viewer AND followee_id = author
+        ))
+        OR EXISTS (
+            SELECT 1 FROM chirp_mentions
+            WHERE chirp_id = target AND user_id = viewer
+        )
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION can_view_chirp;
+
+ALTER TABLE chirps
+DROP COLUMN visibility;
@@ -0,0 +1,92 @@
+-- +goose Up
+ALTER TABLE users
+ADD protected BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- follows of a protected account wait here until its owner answers
+CREATE TABLE follow_requests (
+    requester_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    target_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (requester_id, target_id),
+    CHECK (requester_id <> target_id)
+);
+
+CREATE INDEX follow_requests_target_id_idx ON follow_requests (target_id, created_at DESC);
+
+ALTER TABLE notifications
+DROP CONSTRAINT notifications_type_check,
+ADD CONSTRAINT notifications_type_check
+    CHECK (type IN ('follow', 'mention', 'reply', 'like', 'rechirp', 'follow_request', 'follow_accepted'));
+
+ALTER TABLE notification_preferences
+DROP CONSTRAINT notification_preferences_type_check,
+ADD CONSTRAINT notification_preferences_type_check
+    CHECK (type IN ('follow', 'mention', 'reply', 'like', 'rechirp', 'follow_request', 'follow_accepted'));
+
+-- a protected account's chirps are only for its followers, whatever their
+-- visibility says; on top of that the visibility rules still apply
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION can_view_chirp(target UUID, author UUID, level TEXT, viewer UUID) RETURNS BOOLEAN
+LANGUAGE SQL STABLE AS $$
+    SELECT author = viewer
+        OR (
+            (
+                NOT EXISTS (SELECT 1 FROM users WHERE id = author AND protected)
+                OR EXISTS (
+                    SELECT 1 FROM follows
+                    WHERE follower_id = viewer AND followee_id = author
+                )
+            )
+            AND (
+                level IN ('public', 'unlisted')
+                OR (level = 'followers' AND EXISTS (
+                    SELECT 1 FROM follows
+                    WHERE follower_id = viewer AND followee_id = author
+                ))
+                OR EXISTS (
+                    SELECT 1 FROM chirp_mentions
+                    WHERE chirp_id = target AND user_id = viewer
+                )
+            )
+        )
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION can_view_chirp(target UUID, author UUID, level TEXT, viewer UUID) RETURNS BOOLEAN
+LANGUAGE SQL STABLE AS $$
+    SELECT level IN ('public', 'unlisted')
+        OR author = viewer
+        OR (level = 'followers' AND EXISTS (
+            SELECT 1 FROM follows
+            WHERE follower_id = viewer AND followee_id = author
+        ))
+        OR EXISTS (
+            SELECT 1 FROM chirp_mentions
+            WHERE chirp_id = target AND user_id = viewer
+        )
+$$;
+-- +goose StatementEnd
+
+DELETE FROM notification_preferences
+WHERE type IN ('follow_request', 'follow_accepted');
+DELETE FROM notifications
+WHERE type IN ('follow_request', 'follow_accepted');
+
+ALTER TABLE notification_preferences
+DROP CONSTRAINT notification_preferences_type_check,
+ADD CONSTRAINT notification_preferences_type_check
+    CHECK (type IN ('follow', 'mention', 'reply', 'like', 'rechirp'));
+
+ALTER TABLE notifications
+DROP CONSTRAINT notifications_type_check,
+ADD CONSTRAINT notifications_type_check
+    CHECK (type IN ('follow', 'mention', 'reply', 'like', 'rechirp'));
+
+DROP TABLE follow_requests;
+
+ALTER TABLE users
+DROP COLUMN protected;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- the search query has to spell out the same expression to use it, see
+-- SearchChirps
+CREATE INDEX chirps_body_search_idx ON chirps
+    USING GIN (to_tsvector('english', body))
+    WHERE deleted_at IS NULL;
+
+-- handle lookups by any part of the handle, or something close to it
+CREATE INDEX users_handle_trgm_idx ON users
+    USING GIN (lower(handle) gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX users_handle_trgm_idx;
+DROP INDEX chirps_body_search_idx;
+-- pg_trgm stays, it may have been there before or be used by something else
@@ -0,0 +1,31 @@
+-- +goose Up
+-- uploaded images. The blobs themselves are in blob storage under
+-- storage_key and thumbnail_key. An upload belongs to no chirp until one is
+-- posted with it; uploads that never are, and the attachments of purged
+-- chirps, are swept up along with their blobs.
+CREATE TABLE attachments (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    storage_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL,
+    thumbnail_content_type TEXT NOT NULL,
+    chirp_id UUID REFERENCES chirps(id)
+        ON DELETE SET NULL,
+    -- set once, when the attachment is posted: an upload goes on one chirp
+    -- and is never reused, even after that chirp is purged
+    position INTEGER CHECK (position BETWEEN 0 AND 3),
+    alt_text TEXT NOT NULL DEFAULT '',
+    UNIQUE (chirp_id, position)
+);
+
+CREATE INDEX attachments_unattached_idx ON attachments (created_at)
+    WHERE chirp_id IS NULL;
+
+-- +goose Down
+DROP TABLE attachments;
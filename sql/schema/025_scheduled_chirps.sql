@@ -0,0 +1,33 @@
+-- +goose Up
+-- chirps waiting for their publish_at. They're only checked and turned into
+-- real chirps when that comes, so nothing that lists chirps has to know
+-- about them.
+CREATE TABLE scheduled_chirps (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    publish_at TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    visibility TEXT NOT NULL,
+    -- no foreign keys, the chirps can be purged in the meantime and then
+    -- publishing fails like it would for a deleted one
+    in_reply_to UUID,
+    quote_of UUID,
+    -- why it couldn't be published when its time came, it then waits for
+    -- its author to reschedule or cancel it
+    failed_reason TEXT
+);
+
+CREATE INDEX scheduled_chirps_due_idx ON scheduled_chirps (publish_at)
+    WHERE failed_reason IS NULL;
+CREATE INDEX scheduled_chirps_user_id_idx ON scheduled_chirps (user_id, publish_at);
+
+-- uploads waiting on a scheduled chirp aren't swept up
+ALTER TABLE attachments ADD COLUMN scheduled_chirp_id UUID REFERENCES scheduled_chirps(id)
+    ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE attachments DROP COLUMN scheduled_chirp_id;
+DROP TABLE scheduled_chirps;
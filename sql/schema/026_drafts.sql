@@ -0,0 +1,23 @@
+-- +goose Up
+-- half-written chirps. Nothing about them is checked until they're
+-- published, they go through the same checks as any new chirp then.
+CREATE TABLE drafts (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    visibility TEXT NOT NULL,
+    in_reply_to UUID,
+    quote_of UUID,
+    -- [{"id": ..., "alt_text": ...}], the uploads the chirp will have. They
+    -- aren't swept up while a draft holds them.
+    attachments JSONB NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX drafts_user_id_updated_at_idx ON drafts (user_id, updated_at DESC);
+CREATE INDEX drafts_attachments_idx ON drafts USING GIN (attachments jsonb_path_ops);
+
+-- +goose Down
+DROP TABLE drafts;
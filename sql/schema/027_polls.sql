@@ -0,0 +1,44 @@
+-- +goose Up
+-- a poll on a chirp. It's open until the scheduler closes it, once
+-- closes_at has passed; nothing else looks at closes_at.
+CREATE TABLE polls (
+    chirp_id UUID PRIMARY KEY REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    closes_at TIMESTAMP NOT NULL,
+    closed_at TIMESTAMP
+);
+
+CREATE INDEX polls_open_idx ON polls (closes_at)
+    WHERE closed_at IS NULL;
+
+CREATE TABLE poll_options (
+    chirp_id UUID NOT NULL REFERENCES polls(chirp_id)
+        ON DELETE CASCADE,
+    position INTEGER NOT NULL CHECK (position BETWEEN 0 AND 3),
+    text TEXT NOT NULL,
+    PRIMARY KEY (chirp_id, position)
+);
+
+CREATE TABLE poll_votes (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id)
+        ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    -- one vote per user per poll, and only for one of its options
+    PRIMARY KEY (chirp_id, user_id),
+    FOREIGN KEY (chirp_id, position) REFERENCES poll_options (chirp_id, position)
+        ON DELETE CASCADE
+);
+
+-- the poll a scheduled chirp or a draft will have, {"options": [...],
+-- "closes_at": ...}, or JSON null for none
+ALTER TABLE scheduled_chirps ADD COLUMN poll JSONB NOT NULL DEFAULT 'null';
+ALTER TABLE drafts ADD COLUMN poll JSONB NOT NULL DEFAULT 'null';
+
+-- +goose Down
+ALTER TABLE drafts DROP COLUMN poll;
+ALTER TABLE scheduled_chirps DROP COLUMN poll;
+DROP TABLE poll_votes;
+DROP TABLE poll_options;
+DROP TABLE polls;
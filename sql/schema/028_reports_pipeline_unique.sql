@@ -0,0 +1,23 @@
+-- +goose Up
+-- NULLs are distinct in reports_open_reporter_idx, so it never stopped the
+-- pipeline from filing the same chirp over and over (every flagged edit did).
+-- The extra open ones go, keeping the claimed one or else the oldest.
+DELETE FROM reports
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, status, ROW_NUMBER() OVER (
+            PARTITION BY chirp_id
+            ORDER BY status = 'claimed' DESC, created_at, id
+        ) AS n
+        FROM reports
+        WHERE reporter_id IS NULL AND status <> 'resolved' AND chirp_id IS NOT NULL
+    ) ranked
+    WHERE n > 1 AND status = 'open'
+);
+
+-- one open pipeline report per chirp
+CREATE UNIQUE INDEX reports_open_pipeline_idx ON reports (chirp_id)
+    WHERE reporter_id IS NULL AND status <> 'resolved';
+
+-- +goose Down
+DROP INDEX reports_open_pipeline_idx;
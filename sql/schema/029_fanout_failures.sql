@@ -0,0 +1,16 @@
+-- +goose Up
+-- a job that keeps failing would otherwise be claimed first every time and
+-- hold up every chirp queued after it. After a few attempts it's set aside
+-- with failed_at, clearing that puts it back on the queue.
+ALTER TABLE fanout_queue
+ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN failed_at TIMESTAMP;
+
+CREATE INDEX fanout_queue_pending_idx ON fanout_queue (created_at)
+    WHERE failed_at IS NULL;
+
+-- +goose Down
+DROP INDEX fanout_queue_pending_idx;
+ALTER TABLE fanout_queue
+DROP COLUMN failed_at,
+DROP COLUMN attempts;
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/chirptext"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+	"github.com/whatsmynameagain/go-chirpy/internal/realtime"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// realtime events go through Postgres so they reach every instance: whatever
+// causes one publishes it with PublishEvent (a NOTIFY), and each instance,
+// this one included, LISTENs and feeds what it gets to its hub. The NOTIFY
+// payload only carries IDs, each instance loads what the event is about once
+// when it arrives and its subscribers share the result.
+
+const (
+	eventsChannel = "chirpy_events"
+
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventNotification = "notification"
+	// direct messages and read receipts
+	eventMessageCreated   = "message.created"
+	eventConversationRead = "conversation.read"
+
+	// how many events each instance keeps for clients resuming with
+	// Last-Event-ID
+	streamBufferSize = 1024
+	// a comment is sent this often so idle connections aren't cut by proxies
+	streamHeartbeatInterval = 15 * time.Second
+	// how often a stream reloads the follows, blocks and mutes it filters by
+	streamRefreshInterval = time.Minute
+	// how long clients wait before reconnecting
+	streamRetry = 3 * time.Second
+	// pq recommends pinging an idle listener so a dead connection is noticed
+	listenerPingInterval = 90 * time.Second
+)
+
+// publishedEvent is the NOTIFY payload
+type publishedEvent struct {
+	ID   int64           `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// chirpEvent is published for chirp.created and chirp.deleted
+type chirpEvent struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	RootID  uuid.UUID `json:"root_id"`
+	// only set for chirp.deleted, chirp.created reads it off the chirp
+	Visibility string `json:"visibility,omitempty"`
+}
+
+type notificationEvent struct {
+	NotificationID uuid.UUID `json:"notification_id"`
+	UserID         uuid.UUID `json:"user_id"`
+}
+
+// messageEvent and readReceiptEvent name everyone who gets them, members
+// blocked with the sender are already left out
+type messageEvent struct {
+	MessageID  uuid.UUID   `json:"message_id"`
+	Recipients []uuid.UUID `json:"recipients"`
+}
+
+type readReceiptEvent struct {
+	ReadReceipt
+	Recipients []uuid.UUID `json:"recipients"`
+}
+
+// DeletedChirp is what clients get for chirp.deleted, chirp.created sends the
+// whole Chirp and notification the Notification
+type DeletedChirp struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// publishEvent sends an event to every instance. With a transaction's
+// queries it only goes out if the transaction commits.
+func publishEvent(ctx context.Context, q *database.Queries, kind string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return q.PublishEvent(ctx, database.PublishEventParams{
+		Type: kind,
+		Data: string(payload),
+	})
+}
+
+// runEventListener passes published events to cfg.events until ctx is done
+func (cfg *apiConfig) runEventListener(ctx context.Context, dbURL string) {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("event listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(eventsChannel)
+	if err != nil {
+		log.Printf("error listening for events: %v", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				// the connection dropped and came back, whatever was sent in
+				// between is lost so nobody can resume across the gap
+				log.Printf("event listener reconnected, resetting streams")
+				cfg.events.Reset()
+				continue
+			}
+			cfg.receiveEvent(ctx, n.Extra)
+		case <-time.After(listenerPingInterval):
+			go listener.Ping()
+		}
+	}
+}
+
+func (cfg *apiConfig) receiveEvent(ctx context.Context, payload string) {
+	published := publishedEvent{}
+	err := json.Unmarshal([]byte(payload), &published)
+	if err != nil {
+		log.Printf("error decoding event: %v", err)
+		return
+	}
+
+	event, err := cfg.loadEvent(ctx, &published)
+	if err != nil {
+		// deleted before it could be sent, there's nothing to show
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		log.Printf("error loading %s event %d: %v", published.Type, published.ID, err)
+		return
+	}
+	cfg.events.Publish(event)
+}
+
+// loadEvent turns a published event into what's sent to clients
+func (cfg *apiConfig) loadEvent(ctx context.Context, published *publishedEvent) (realtime.Event, error) {
+	event := realtime.Event{ID: published.ID, Type: published.Type}
+	var err error
+	switch published.Type {
+	case eventChirpCreated:
+		err = cfg.loadChirpCreated(ctx, published.Data, &event)
+	case eventChirpDeleted:
+		data := chirpEvent{}
+		err = json.Unmarshal(published.Data, &data)
+		if err == nil {
+			event.Actor = data.UserID
+			event.Thread = data.RootID
+			err = cfg.chirpAudience(ctx, data.ChirpID, data.UserID, data.Visibility, &event)
+		}
+		if err == nil {
+			event.Data, err = json.Marshal(DeletedChirp{ID: data.ChirpID, UserID: data.UserID})
+		}
+	case eventNotification:
+		err = cfg.loadNotification(ctx, published.Data, &event)
+	case eventMessageCreated:
+		data := messageEvent{}
+		err = json.Unmarshal(published.Data, &data)
+		if err != nil {
+			break
+		}
+		var msg database.Message
+		msg, err = cfg.dbQueries.GetMessageByID(ctx, data.MessageID)
+		if err == nil {
+			event.Actor = msg.SenderID
+			event.Recipients = data.Recipients
+			event.Data, err = json.Marshal(dbMessageToJSON(&msg))
+		}
+	case eventConversationRead:
+		data := readReceiptEvent{}
+		err = json.Unmarshal(published.Data, &data)
+		if err == nil {
+			event.Actor = data.UserID
+			event.Recipients = data.Recipients
+			event.Data, err = json.Marshal(data.ReadReceipt)
+		}
+	default:
+		err = fmt.Errorf("unknown event type %q", published.Type)
+	}
+	return event, err
+}
+
+// loadChirpCreated renders the chirp as an anonymous viewer would see it,
+// which for one that was just posted only leaves out liked_by_me, and that
+// can't be true yet
+func (cfg *apiConfig) loadChirpCreated(ctx context.Context, raw json.RawMessage, event *realtime.Event) error {
+	data := chirpEvent{}
+	err := json.Unmarshal(raw, &data)
+	if err != nil {
+		return err
+	}
+	chrp, err := cfg.dbQueries.GetChirpByID(ctx, data.ChirpID)
+	if err != nil {
+		return err
+	}
+	if chrp.DeletedAt.Valid {
+		return sql.ErrNoRows
+	}
+	jsonChirps, err := cfg.chirpsToJSON(ctx, uuid.Nil, []database.Chirp{chrp})
+	if err != nil {
+		return err
+	}
+
+	event.Actor = chrp.UserID
+	if quoted := jsonChirps[0].QuotedChirp; quoted != nil && quoted.UserID != nil {
+		event.Involved = []uuid.UUID{*quoted.UserID}
+	}
+	event.Tags = chirptext.Hashtags(chrp.Body)
+	event.Thread = conversationRoot(&chrp)
+	err = cfg.chirpAudience(ctx, chrp.ID, chrp.UserID, chrp.Visibility, event)
+	if err != nil {
+		return err
+	}
+	event.Data, err = json.Marshal(jsonChirps[0])
+	return err
+}
+
+// chirpAudience fills in who may see a chirp event. Followers are checked
+// against each stream's own follow list, only whether the author is
+// protected and the mentioned users have to be looked up.
+func (cfg *apiConfig) chirpAudience(ctx context.Context, chirpID, authorID uuid.UUID, visibility string, event *realtime.Event) error {
+	author, err := cfg.dbQueries.GetUserByID(ctx, authorID)
+	if err != nil {
+		return err
+	}
+	event.Protected = author.Protected
+	event.Visibility = visibility
+	if visibility != visibilityFollowers && visibility != visibilityMentioned {
+		return nil
+	}
+	mentions, err := cfg.dbQueries.GetChirpMentions(ctx, []uuid.UUID{chirpID})
+	if err != nil {
+		return err
+	}
+	event.Mentioned = []uuid.UUID{}
+	for _, m := range mentions {
+		event.Mentioned = append(event.Mentioned, m.UserID)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) loadNotification(ctx context.Context, raw json.RawMessage, event *realtime.Event) error {
+	data := notificationEvent{}
+	err := json.Unmarshal(raw, &data)
+	if err != nil {
+		return err
+	}
+	row, err := cfg.dbQueries.GetNotificationByID(ctx, data.NotificationID)
+	if err != nil {
+		return err
+	}
+	notifications, err := cfg.notificationsToJSON(ctx, []database.Notification{row})
+	if err != nil {
+		return err
+	}
+
+	event.Recipients = []uuid.UUID{row.UserID}
+	event.Data, err = json.Marshal(notifications[0])
+	return err
+}
+
+// streamFilter decides which events a stream gets
+type streamFilter struct {
+	viewer   uuid.UUID
+	timeline bool
+	author   uuid.UUID
+	hashtag  string
+
+	// reloaded every streamRefreshInterval
+	following map[uuid.UUID]bool
+	blocked   map[uuid.UUID]bool
+	muted     map[uuid.UUID]bool
+}
+
+func parseStreamFilter(r *http.Request, viewer uuid.UUID) (streamFilter, error) {
+	query := r.URL.Query()
+	filter := streamFilter{
+		viewer:   viewer,
+		timeline: query.Get("timeline") == "true",
+	}
+	if author := query.Get("author"); author != "" {
+		authorID, err := uuid.Parse(author)
+		if err != nil {
+			return filter, errors.New("invalid author ID")
+		}
+		filter.author = authorID
+	}
+	if hashtag := query.Get("hashtag"); hashtag != "" {
+		filter.hashtag = chirptext.NormalizeHashtag(strings.TrimLeft(hashtag, "#＃"))
+		if filter.hashtag == "" {
+			return filter, errors.New("invalid hashtag")
+		}
+	}
+	return filter, nil
+}
+
+func (cfg *apiConfig) loadStreamFilter(ctx context.Context, filter *streamFilter) error {
+	blocked, err := cfg.blockedUsers(ctx, filter.viewer)
+	if err != nil {
+		return err
+	}
+	filter.blocked = blocked
+
+	// followers-only chirps need the follow list whatever the stream
+	filter.following = map[uuid.UUID]bool{}
+	if filter.viewer != uuid.Nil {
+		followeeIDs, err := cfg.dbQueries.GetFolloweeIDs(ctx, filter.viewer)
+		if err != nil {
+			return err
+		}
+		filter.following[filter.viewer] = true
+		for _, userID := range followeeIDs {
+			filter.following[userID] = true
+		}
+	}
+
+	if !filter.timeline {
+		return nil
+	}
+	mutedIDs, err := cfg.dbQueries.GetMutedUserIDs(ctx, filter.viewer)
+	if err != nil {
+		return err
+	}
+	filter.muted = make(map[uuid.UUID]bool, len(mutedIDs))
+	for _, userID := range mutedIDs {
+		filter.muted[userID] = true
+	}
+	return nil
+}
+
+// allows applies the same rules as the listings: blocks and visibility hide
+// everything, unlisted chirps only show on the timeline and author streams,
+// mutes only apply to the timeline. Deletes can't be matched to a hashtag
+// since the chirp is gone, so they pass that filter and clients ignore the
+// ones they never had.
+func (f *streamFilter) allows(e *realtime.Event) bool {
+	if e.Recipients != nil {
+		return f.viewer != uuid.Nil && slices.Contains(e.Recipients, f.viewer)
+	}
+	if f.blocks(e) || !f.sees(e) {
+		return false
+	}
+	if e.Visibility == visibilityUnlisted && (f.hashtag != "" || (!f.timeline && f.author == uuid.Nil)) {
+		return false
+	}
+	if f.author != uuid.Nil && e.Actor != f.author {
+		return false
+	}
+	if f.timeline && (!f.following[e.Actor] || f.muted[e.Actor]) {
+		return false
+	}
+	if f.hashtag != "" && e.Type == eventChirpCreated && !slices.Contains(e.Tags, f.hashtag) {
+		return false
+	}
+	return true
+}
+
+// blocks is whether the event involves someone blocked either way with the
+// viewer
+func (f *streamFilter) blocks(e *realtime.Event) bool {
+	if f.blocked[e.Actor] {
+		return true
+	}
+	for _, userID := range e.Involved {
+		if f.blocked[userID] {
+			return true
+		}
+	}
+	return false
+}
+
+// sees is can_view_chirp for a chirp event
+func (f *streamFilter) sees(e *realtime.Event) bool {
+	if e.Protected && !f.following[e.Actor] {
+		return false
+	}
+	switch e.Visibility {
+	case visibilityFollowers:
+		if f.following[e.Actor] {
+			return true
+		}
+	case visibilityMentioned:
+	default:
+		return true
+	}
+	return f.viewer != uuid.Nil && (e.Actor == f.viewer || slices.Contains(e.Mentioned, f.viewer))
+}
+
+// parseLastEventID reads where a reconnecting client left off, from the
+// Last-Event-ID header browsers send or ?last_event_id= for clients that
+// can't set headers
+func parseLastEventID(r *http.Request) (resume bool, lastID int64, err error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return false, 0, nil
+	}
+	lastID, err = strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return false, 0, errors.New("invalid Last-Event-ID")
+	}
+	return true, lastID, nil
+}
+
+func writeEvent(w io.Writer, e *realtime.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	return err
+}
+
+// streamEvents is GET /api/stream: new chirps, deleted chirps and the
+// caller's own notifications and direct messages as Server-Sent Events.
+// Chirps can be narrowed down with ?timeline=true (the caller's home
+// timeline), ?author=<user ID> and ?hashtag=<tag>, which combine. A client
+// reconnecting with Last-Event-ID gets what it missed, or a reset event when
+// that's too far back and it should reload instead.
+func (cfg *apiConfig) streamEvents(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	filter, err := parseStreamFilter(r, viewer)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if filter.timeline && viewer == uuid.Nil {
+		respondWithError(w, 401, "log in to stream your timeline")
+		return
+	}
+	resume, lastID, err := parseLastEventID(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	err = cfg.loadStreamFilter(r.Context(), &filter)
+	if err != nil {
+		fmt.Println("error loading stream filter: ", err)
+		respondWithError(w, 500, "failed to start stream")
+		return
+	}
+
+	sub, replay, found := cfg.events.Subscribe(resume, lastID)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if err == nil && !found {
+		_, err = io.WriteString(w, "event: reset\ndata: {}\n\n")
+	}
+	for i := 0; err == nil && i < len(replay); i++ {
+		if filter.allows(&replay[i]) {
+			err = writeEvent(w, &replay[i])
+		}
+	}
+	if err == nil {
+		err = rc.Flush()
+	}
+	if err != nil {
+		fmt.Println("error starting stream: ", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	refresh := time.NewTicker(streamRefreshInterval)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, open := <-sub.Events():
+			// when the hub dropped us for falling behind, the client
+			// reconnects and resumes from the buffer
+			if !open {
+				return
+			}
+			if !filter.allows(&e) {
+				continue
+			}
+			err = writeEvent(w, &e)
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": ping\n\n")
+		case <-refresh.C:
+			// keep the old sets if the reload fails, they're only a minute out
+			refreshErr := cfg.loadStreamFilter(r.Context(), &filter)
+			if refreshErr != nil {
+				fmt.Println("error refreshing stream filter: ", refreshErr)
+			}
+			continue
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
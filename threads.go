@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+)
+
+// ThreadNode is a chirp in a conversation tree. Deleted chirps keep their
+// place so the replies under them still make sense, but lose their body.
+type ThreadNode struct {
+	Chirp
+	Deleted bool          `json:"deleted,omitempty"`
+	Replies []*ThreadNode `json:"replies"`
+}
+
+// ThreadAncestor is a chirp above the requested one. Like a ThreadNode it
+// keeps its place when it's deleted, and the same goes for one by a blocked
+// user or that the viewer isn't allowed to see, which is left with nothing
+// but its place and marked unavailable.
+type ThreadAncestor struct {
+	Chirp
+	Deleted     bool `json:"deleted,omitempty"`
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+type Thread struct {
+	// the chain of chirps the requested one replies to, root first
+	Ancestors []ThreadAncestor `json:"ancestors"`
+	Chirp     *ThreadNode      `json:"chirp"`
+}
+
+// getThread returns a chirp with the conversation around it: every chirp
+// above it up to the root, and the replies below it down to ?depth= levels.
+// limit/offset paginate the direct replies.
+func (cfg *apiConfig) getThread(w http.ResponseWriter, r *http.Request) {
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "invalid chirp ID")
+		return
+	}
+
+	depth := defaultThreadDepth
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		depth, err = strconv.Atoi(raw)
+		if err != nil || depth < 1 || depth > maxThreadDepth {
+			respondWithError(w, 400, fmt.Sprintf("depth must be between 1 and %d", maxThreadDepth))
+			return
+		}
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 404, "no chirp found with the requested ID")
+			return
+		}
+		fmt.Println("error fetching chirp from database: ", err)
+		respondWithError(w, 500, "failed to fetch thread")
+		return
+	}
+	if cfg.respondIfHidden(w, r, viewer, &chirp, "no chirp found with the requested ID") {
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithTombstone(w, &chirp)
+		return
+	}
+
+	ancestors, err := cfg.dbQueries.GetChirpAncestors(r.Context(), chirpID)
+	if err != nil {
+		fmt.Println("error fetching chirp ancestors: ", err)
+		respondWithError(w, 500, "failed to fetch thread")
+		return
+	}
+
+	replyRows, err := cfg.dbQueries.GetChirpReplies(r.Context(), database.GetChirpRepliesParams{
+		ChirpID:    uuid.NullUUID{UUID: chirpID, Valid: true},
+		ViewerID:   viewer,
+		PageLimit:  limit,
+		PageOffset: offset,
+		MaxDepth:   int32(depth),
+	})
+	if err != nil {
+		fmt.Println("error fetching chirp replies: ", err)
+		respondWithError(w, 500, "failed to fetch thread")
+		return
+	}
+
+	// everything goes through chirpsToJSON in one go so the counts are
+	// fetched once for the whole thread
+	all := make([]database.Chirp, 0, len(ancestors)+1+len(replyRows))
+	all = append(all, ancestors...)
+	all = append(all, chirp)
+	for _, row := range replyRows {
+		all = append(all, row.Chirp)
+	}
+	jsonChirps, err := cfg.chirpsToJSON(r.Context(), viewer, all)
+	if err != nil {
+		fmt.Println("error building thread: ", err)
+		respondWithError(w, 500, "failed to fetch thread")
+		return
+	}
+
+	// the chain above can't skip a chirp without breaking, so ones by
+	// blocked users or that the viewer isn't allowed to see stay but are
+	// blanked out like deleted ones
+	blocked, err := cfg.blockedUsers(r.Context(), viewer)
+	if err != nil {
+		fmt.Println("error fetching blocks: ", err)
+		respondWithError(w, 500, "failed to fetch thread")
+		return
+	}
+	viewable, err := cfg.viewableChirps(r.Context(), viewer, ancestors)
+	if err != nil {
+		fmt.Println("error checking chirp visibility: ", err)
+		respondWithError(w, 500, "failed to fetch thread")
+		return
+	}
+
+	thread := Thread{Ancestors: []ThreadAncestor{}}
+	for i := range ancestors {
+		ancestor := ThreadAncestor{
+			Chirp:   redactDeleted(jsonChirps[i], &all[i]),
+			Deleted: all[i].DeletedAt.Valid,
+		}
+		if blocked[all[i].UserID] || !viewable[all[i].ID] {
+			ancestor = ThreadAncestor{
+				Chirp:       redactBlocked(ancestor.Chirp),
+				Unavailable: true,
+			}
+		}
+		thread.Ancestors = append(thread.Ancestors, ancestor)
+	}
+
+	nodes := map[uuid.UUID]*ThreadNode{}
+	rootIndex := len(ancestors)
+	thread.Chirp = &ThreadNode{Chirp: jsonChirps[rootIndex], Replies: []*ThreadNode{}}
+	nodes[chirp.ID] = thread.Chirp
+
+	// rows come ordered by depth, so a reply's parent is always placed
+	// before the reply itself
+	for i := rootIndex + 1; i < len(all); i++ {
+		node := &ThreadNode{
+			Chirp:   redactDeleted(jsonChirps[i], &all[i]),
+			Deleted: all[i].DeletedAt.Valid,
+			Replies: []*ThreadNode{},
+		}
+		nodes[node.ID] = node
+		if parent, ok := nodes[all[i].InReplyTo.UUID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	err = respondWithJSON(w, 200, thread)
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
+
+// conversationRoot is the first chirp of the conversation a chirp is part of,
+// the chirp itself when it isn't a reply
+func conversationRoot(chrp *database.Chirp) uuid.UUID {
+	if chrp.RootID.Valid {
+		return chrp.RootID.UUID
+	}
+	return chrp.ID
+}
+
+// redactDeleted blanks out the content of a deleted chirp shown for context:
+// its body, what it quoted, its attachments and its poll
+func redactDeleted(chirp Chirp, dbChirp *database.Chirp) Chirp {
+	if dbChirp.DeletedAt.Valid {
+		chirp.Body = ""
+		chirp.Mentions = nil
+		chirp.QuoteOf = nil
+		chirp.QuotedChirp = nil
+		chirp.Attachments = nil
+		chirp.Poll = nil
+	}
+	return chirp
+}
+
+// redactBlocked keeps only where a chirp sits in the thread, not what it
+// says or who wrote it. Chirps the viewer isn't allowed to see get the same.
+func redactBlocked(chirp Chirp) Chirp {
+	return Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		InReplyTo: chirp.InReplyTo,
+		RootID:    chirp.RootID,
+	}
+}
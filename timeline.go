@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// ChirpPage is a page of a keyset paginated listing. NextCursor goes in
+// ?cursor= to get the page after it, it's empty on the last page.
+type ChirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// getTimeline is the caller's home feed: their own chirps and the chirps of
+// everyone they follow, newest first
+func (cfg *apiConfig) getTimeline(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, after, err := parseKeysetPagination(r)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	dbChirps, err := cfg.homeTimeline(r.Context(), user.ID, after, limit)
+	if err != nil {
+		fmt.Println("error fetching timeline: ", err)
+		respondWithError(w, 500, "failed to fetch timeline")
+		return
+	}
+
+	cfg.respondWithChirpPage(w, r, user.ID, dbChirps, limit)
+}
+
+// respondWithChirpPage sends a ChirpPage, with a next cursor if the page came
+// back full
+func (cfg *apiConfig) respondWithChirpPage(w http.ResponseWriter, r *http.Request, viewer uuid.UUID, dbChirps []database.Chirp, limit int32) {
+	jsonChirps, err := cfg.chirpsToJSON(r.Context(), viewer, dbChirps)
+	if err != nil {
+		fmt.Println("error building chirps response: ", err)
+		respondWithError(w, 500, "failed to build chirps response")
+		return
+	}
+
+	page := ChirpPage{Chirps: jsonChirps}
+	if len(dbChirps) == int(limit) {
+		last := dbChirps[len(dbChirps)-1]
+		page.NextCursor = cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+	}
+	respondWithJSON(w, 200, page)
+}
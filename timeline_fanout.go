@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// home timelines are materialized: when a chirp is created a job goes into
+// fanout_queue in the same transaction, and the fan-out workers copy it into
+// timeline_entries for the author and each of their followers. Accounts with
+// more than cfg.fanoutThreshold followers are skipped by the fan-out (one
+// chirp would mean that many inserts), their chirps are pulled in when the
+// timeline is read instead.
+
+const (
+	// how often an idle worker checks the queue, new chirps also wake one up
+	// straight away
+	fanoutPollInterval = time.Second
+	// how many of an account's chirps land in a timeline when it's followed
+	followBackfillSize = 100
+	// how many times a job is tried before it's set aside
+	maxFanoutAttempts = 5
+)
+
+// wakeFanout nudges an idle worker, it never blocks since a pending nudge
+// already means someone is about to look at the queue
+func (cfg *apiConfig) wakeFanout() {
+	select {
+	case cfg.fanoutWake <- struct{}{}:
+	default:
+	}
+}
+
+// runFanoutWorker works through the fan-out queue until ctx is done, several
+// can run at once since each job is claimed with SKIP LOCKED
+func (cfg *apiConfig) runFanoutWorker(ctx context.Context) {
+	ticker := time.NewTicker(fanoutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain the queue before going back to sleep
+		for {
+			done, err := cfg.fanOutNext(ctx)
+			if err != nil {
+				log.Printf("error fanning out chirp: %v", err)
+				break
+			}
+			if done {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-cfg.fanoutWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// fanOutNext claims one job and delivers it, done is true when the queue is
+// empty. The job is removed in the same transaction as the inserts, so if
+// anything fails it goes back on the queue for the next try, until it's
+// failed maxFanoutAttempts times and is set aside.
+func (cfg *apiConfig) fanOutNext(ctx context.Context) (done bool, err error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	chirpID, err := qtx.ClaimFanoutJob(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	_, err = qtx.FanOutChirp(ctx, database.FanOutChirpParams{
+		ChirpID:           chirpID,
+		FollowerThreshold: cfg.fanoutThreshold,
+	})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err == nil {
+		return false, nil
+	}
+
+	// the attempt is counted after the rollback puts the job back
+	tx.Rollback()
+	failedAt, recordErr := cfg.dbQueries.RecordFanoutFailure(ctx, database.RecordFanoutFailureParams{
+		MaxAttempts: maxFanoutAttempts,
+		ChirpID:     chirpID,
+	})
+	if recordErr != nil && !errors.Is(recordErr, sql.ErrNoRows) {
+		log.Printf("error recording fan-out failure for chirp %s: %v", chirpID, recordErr)
+	}
+	if failedAt.Valid {
+		log.Printf("setting aside fan-out of chirp %s after %d attempts", chirpID, maxFanoutAttempts)
+	}
+	return false, fmt.Errorf("chirp %s: %w", chirpID, err)
+}
+
+// homeTimeline reads a page of the materialized timeline and merges in the
+// chirps of followed accounts that are too big to fan out
+func (cfg *apiConfig) homeTimeline(ctx context.Context, userID uuid.UUID, after cursor, limit int32) ([]database.Chirp, error) {
+	materialized, err := cfg.dbQueries.GetMaterializedTimeline(ctx, database.GetMaterializedTimelineParams{
+		UserID:          userID,
+		BeforeCreatedAt: after.CreatedAt,
+		BeforeID:        after.ID,
+		PageLimit:       limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pulled, err := cfg.dbQueries.GetLargeAccountTimeline(ctx, database.GetLargeAccountTimelineParams{
+		UserID:            userID,
+		FollowerThreshold: cfg.fanoutThreshold,
+		BeforeCreatedAt:   after.CreatedAt,
+		BeforeID:          after.ID,
+		PageLimit:         limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeTimelines(materialized, pulled, int(limit)), nil
+}
+
+// mergeTimelines merges two newest-first lists into one of at most limit
+// chirps. An account that grew past the threshold has both fanned out and
+// pulled chirps, so duplicates are dropped.
+func mergeTimelines(a, b []database.Chirp, limit int) []database.Chirp {
+	merged := make([]database.Chirp, 0, min(len(a)+len(b), limit))
+	seen := make(map[uuid.UUID]bool, cap(merged))
+	for len(merged) < limit && (len(a) > 0 || len(b) > 0) {
+		var next database.Chirp
+		if len(b) == 0 || (len(a) > 0 && newerChirp(&a[0], &b[0])) {
+			next, a = a[0], a[1:]
+		} else {
+			next, b = b[0], b[1:]
+		}
+		if seen[next.ID] {
+			continue
+		}
+		seen[next.ID] = true
+		merged = append(merged, next)
+	}
+	return merged
+}
+
+// newerChirp is the timeline order, the same (created_at, id) descending the
+// cursors use
+func newerChirp(a, b *database.Chirp) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID.String() > b.ID.String()
+}
+
+// rebuildTimeline throws away a user's materialized timeline and fills it
+// again from their follows, for when it's drifted or the threshold changed
+func (cfg *apiConfig) rebuildTimeline(ctx context.Context, userID uuid.UUID) (int64, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.ClearTimeline(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := qtx.RebuildTimeline(ctx, database.RebuildTimelineParams{
+		UserID:            userID,
+		FollowerThreshold: cfg.fanoutThreshold,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return entries, tx.Commit()
+}
+
+// checkTimeline compares the first n chirps of the hybrid timeline with what
+// the plain pull query (GetHomeTimeline) says they should be. missing are
+// chirps the timeline should have but doesn't, extra are ones it shouldn't.
+// Chirps still waiting in the fan-out queue show up as missing.
+func (cfg *apiConfig) checkTimeline(ctx context.Context, userID uuid.UUID, n int32) (missing, extra []uuid.UUID, err error) {
+	start := firstPageCursor
+	want, err := cfg.dbQueries.GetHomeTimeline(ctx, database.GetHomeTimelineParams{
+		UserID:          userID,
+		BeforeCreatedAt: start.CreatedAt,
+		BeforeID:        start.ID,
+		PageLimit:       n,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	got, err := cfg.homeTimeline(ctx, userID, start, n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wantIDs := make(map[uuid.UUID]bool, len(want))
+	for _, chrp := range want {
+		wantIDs[chrp.ID] = true
+	}
+	gotIDs := make(map[uuid.UUID]bool, len(got))
+	for _, chrp := range got {
+		gotIDs[chrp.ID] = true
+		if !wantIDs[chrp.ID] {
+			extra = append(extra, chrp.ID)
+		}
+	}
+	for _, chrp := range want {
+		if !gotIDs[chrp.ID] {
+			missing = append(missing, chrp.ID)
+		}
+	}
+	return missing, extra, nil
+}
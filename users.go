@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/auth"
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// a missing, malformed, expired or forged token
+	errInvalidToken     = errors.New("could not validate JWT")
+	errAccountSuspended = errors.New("account is suspended")
+	errNotAdmin         = errors.New("user is not an admin")
+)
+
+// authenticate pulls the bearer JWT off the request, validates it and loads
+// the user it belongs to. A bad token is an errInvalidToken, and a valid
+// token for a suspended account is rejected with errAccountSuspended so
+// callers can tell the two cases apart. Anything else went wrong on our end.
+func (cfg *apiConfig) authenticate(r *http.Request) (database.User, error) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return database.User{}, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+	return cfg.authenticateToken(r.Context(), tokenString)
+}
+
+// authenticateToken is authenticate for a token that didn't come in the
+// Authorization header
+func (cfg *apiConfig) authenticateToken(ctx context.Context, tokenString string) (database.User, error) {
+	userUUID, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		return database.User{}, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(ctx, userUUID)
+	if err != nil {
+		return database.User{}, fmt.Errorf("could not load user: %w", err)
+	}
+
+	if user.SuspendedAt.Valid {
+		return database.User{}, errAccountSuspended
+	}
+	return user, nil
+}
+
+// optionalViewer is for routes that work without logging in but show more
+// to logged in users (liked_by_me and the like). No Authorization header
+// means an anonymous viewer, uuid.Nil; a header with a bad token is still an
+// error.
+func (cfg *apiConfig) optionalViewer(r *http.Request) (uuid.UUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, nil
+	}
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return user.ID, nil
+}
+
+// authenticateAdmin is authenticate for routes only admins may use
+func (cfg *apiConfig) authenticateAdmin(r *http.Request) (database.User, error) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		return database.User{}, err
+	}
+	if !user.IsAdmin {
+		return database.User{}, errNotAdmin
+	}
+	return user, nil
+}
+
+// respondWithAuthError maps an authenticate() error to the matching status
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errAccountSuspended) {
+		respondWithError(w, http.StatusForbidden, "account is suspended")
+		return
+	}
+	if errors.Is(err, errNotAdmin) {
+		respondWithError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "user no longer exists")
+		return
+	}
+	if errors.Is(err, errInvalidToken) {
+		respondWithError(w, http.StatusUnauthorized, "could not validate JWT")
+		return
+	}
+	// the token may well be fine, telling the client otherwise would make it
+	// drop a good session
+	fmt.Println("error authenticating: ", err)
+	respondWithError(w, http.StatusInternalServerError, "failed to authenticate")
+}
+
+func (cfg *apiConfig) getCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	err = respondWithJSON(w, 200, User{
+		Id:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email:     user.Email,
+		Handle:    user.Handle,
+		Protected: user.Protected,
+	})
+	if err != nil {
+		fmt.Println("error responding: ", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/whatsmynameagain/go-chirpy/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// who can see a chirp is set when it's written. Anyone can open a public or
+// unlisted chirp, but unlisted ones stay out of the public listings (all
+// chirps, hashtags and search) and only show up on the author's profile and
+// in timelines. Followers-only chirps are for followers and mentioned-only
+// chirps for the users they mention, who can also see followers-only ones.
+// On top of that a protected account's chirps are only for its followers
+// (see follow_requests.go). The SQL side of this is can_view_chirp, every
+// listing filters with it.
+
+const (
+	visibilityPublic    = "public"
+	visibilityUnlisted  = "unlisted"
+	visibilityFollowers = "followers"
+	visibilityMentioned = "mentioned"
+)
+
+var chirpVisibilities = []string{
+	visibilityPublic,
+	visibilityUnlisted,
+	visibilityFollowers,
+	visibilityMentioned,
+}
+
+// parseVisibility checks a visibility from a request, leaving it out means
+// public
+func parseVisibility(raw string) (string, error) {
+	if raw == "" {
+		return visibilityPublic, nil
+	}
+	if !slices.Contains(chirpVisibilities, raw) {
+		return "", fmt.Errorf("visibility must be one of %v", chirpVisibilities)
+	}
+	return raw, nil
+}
+
+// viewableChirps is the set of dbChirps the viewer is allowed to see, blocks
+// aside, for chirps fetched by ID rather than listed. Only the viewer's own
+// chirps are known without asking the database, even a public chirp can be
+// from a protected account.
+func (cfg *apiConfig) viewableChirps(ctx context.Context, viewer uuid.UUID, dbChirps []database.Chirp) (map[uuid.UUID]bool, error) {
+	viewable := make(map[uuid.UUID]bool, len(dbChirps))
+	var check []uuid.UUID
+	for i := range dbChirps {
+		if viewer != uuid.Nil && dbChirps[i].UserID == viewer {
+			viewable[dbChirps[i].ID] = true
+		} else {
+			check = append(check, dbChirps[i].ID)
+		}
+	}
+	if len(check) == 0 {
+		return viewable, nil
+	}
+
+	ids, err := cfg.dbQueries.GetViewableChirpIDs(ctx, database.GetViewableChirpIDsParams{
+		Ids:      check,
+		ViewerID: viewer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		viewable[id] = true
+	}
+	return viewable, nil
+}
+
+// canViewChirp is viewableChirps for a single chirp
+func (cfg *apiConfig) canViewChirp(ctx context.Context, viewer uuid.UUID, chrp *database.Chirp) (bool, error) {
+	viewable, err := cfg.viewableChirps(ctx, viewer, []database.Chirp{*chrp})
+	if err != nil {
+		return false, err
+	}
+	return viewable[chrp.ID], nil
+}
+
+// respondIfHidden answers 404 when the viewer isn't allowed to see a chirp,
+// because of a block or its visibility, as if it didn't exist. It returns
+// true if a response was written.
+func (cfg *apiConfig) respondIfHidden(w http.ResponseWriter, r *http.Request, viewer uuid.UUID, chrp *database.Chirp, notFound string) bool {
+	if cfg.respondIfBlocked(w, r, viewer, chrp.UserID, notFound) {
+		return true
+	}
+	visible, err := cfg.canViewChirp(r.Context(), viewer, chrp)
+	if err != nil {
+		fmt.Println("error checking chirp visibility: ", err)
+		respondWithError(w, 500, "failed to check chirp visibility")
+		return true
+	}
+	if !visible {
+		respondWithError(w, 404, notFound)
+		return true
+	}
+	return false
+}